@@ -0,0 +1,71 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"flag"
+	"log"
+	"os"
+	"time"
+
+	"github.com/goriiin/go-proxy/internal/ca"
+)
+
+const defaultCAValidity = 10 * 365 * 24 * time.Hour
+
+// genCA — подкоманда "gen-ca": создаёт корневой сертификат вместо gen_ca.sh.
+//
+//	main gen-ca -key-type ecdsa-p256 -days 3650 -cn "My Proxy CA"
+//
+// С -parent-cert/-parent-key создаётся промежуточный CA, подписанный
+// корнем: корень можно хранить offline, а на прокси держать только промежуточный.
+func genCA(args []string) {
+	fs := flag.NewFlagSet("gen-ca", flag.ExitOnError)
+	certPath := fs.String("cert", "ca.crt", "Where to write the CA certificate")
+	keyPath := fs.String("key", "ca.key", "Where to write the CA private key")
+	keyType := fs.String("key-type", ca.KeyRSA2048, "Key type: rsa2048, ecdsa-p256 or ed25519")
+	days := fs.Int("days", int(defaultCAValidity/(24*time.Hour)), "Validity in days")
+	cn := fs.String("cn", "go-proxy CA", "Subject common name")
+	org := fs.String("org", "go-proxy", "Subject organization")
+	parentCert := fs.String("parent-cert", "", "Issue an intermediate CA signed by this CA certificate (chain)")
+	parentKey := fs.String("parent-key", "", "Private key of -parent-cert")
+	_ = fs.Parse(args)
+
+	opts := ca.Options{
+		KeyType:      *keyType,
+		Validity:     time.Duration(*days) * 24 * time.Hour,
+		CommonName:   *cn,
+		Organization: *org,
+	}
+	if *parentCert != "" {
+		parent, err := tls.LoadX509KeyPair(*parentCert, *parentKey)
+		if err != nil {
+			log.Fatalf("cannot load parent CA: %v", err)
+		}
+		if parent.Leaf, err = x509.ParseCertificate(parent.Certificate[0]); err != nil {
+			log.Fatalf("cannot parse parent CA: %v", err)
+		}
+		opts.Parent = &parent
+	}
+
+	if err := ca.WriteFiles(*certPath, *keyPath, opts); err != nil {
+		log.Fatalf("cannot create CA: %v", err)
+	}
+	log.Printf("CA written to %s and %s", *certPath, *keyPath)
+}
+
+// defaultCA — параметры CA, который создаётся при первом запуске.
+func defaultCA(keyType string) ca.Options {
+	return ca.Options{
+		KeyType:      keyType,
+		Validity:     defaultCAValidity,
+		CommonName:   "go-proxy CA",
+		Organization: "go-proxy",
+	}
+}
+
+func missing(path string) bool {
+	_, err := os.Stat(path)
+	return errors.Is(err, os.ErrNotExist)
+}
@@ -1,41 +1,144 @@
 package api
 
 import (
+	"crypto/x509"
 	"encoding/json"
+	"errors"
+	"log"
 	"net/http"
 	"strconv"
 
 	"github.com/gorilla/mux"
 
+	"github.com/goriiin/go-proxy/internal/certcache"
+	"github.com/goriiin/go-proxy/internal/intercept"
+	"github.com/goriiin/go-proxy/internal/proxy"
+	"github.com/goriiin/go-proxy/internal/rewrite"
 	"github.com/goriiin/go-proxy/internal/scanner"
+	"github.com/goriiin/go-proxy/internal/scope"
 	"github.com/goriiin/go-proxy/internal/store"
+	"github.com/goriiin/go-proxy/internal/upstream"
 )
 
-func Start(s *store.Store, p *scanner.Scanner) {
+// Deps — компоненты, которыми управляет REST‑API.
+type Deps struct {
+	Store       *store.Store
+	Scanner     *scanner.Scanner
+	Transport   *upstream.Transport
+	Intercept   *intercept.Interceptor
+	Rewrite     *rewrite.Engine
+	Scope       *scope.Scope
+	Passthrough *proxy.Passthrough
+	CertCache   *certcache.Cache
+	CA          *x509.Certificate
+	WebSockets  *proxy.WebSockets
+}
+
+func Start(addr string, d Deps) {
+	s, p, t := d.Store, d.Scanner, d.Transport
 	r := mux.NewRouter()
 
+	// ?all=1 — вся история, без фильтра по scope; ?tls.<поле>=… — фильтр по TLS (см. filterTLS)
 	r.HandleFunc("/requests", func(w http.ResponseWriter, r *http.Request) {
 		list, _ := s.List()
+		if all, _ := strconv.ParseBool(r.URL.Query().Get("all")); !all {
+			list = filterScope(list, d.Scope)
+		}
+		list = filterTLS(list, r.URL.Query())
+		for _, item := range list {
+			encodeBodies(item)
+		}
 		_ = json.NewEncoder(w).Encode(list)
 	}).Methods(http.MethodGet)
 
 	r.HandleFunc("/requests/{id}", func(w http.ResponseWriter, r *http.Request) {
 		id, _ := strconv.ParseUint(mux.Vars(r)["id"], 10, 64)
-		item, _ := s.Get(id)
-		_ = json.NewEncoder(w).Encode(item)
+		item, err := s.Get(id)
+		if errors.Is(err, store.ErrNotFound) {
+			writeError(w, http.StatusNotFound, err)
+			return
+		}
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(encodeBodies(item))
 	}).Methods(http.MethodGet)
 
 	r.HandleFunc("/repeat/{id}", func(w http.ResponseWriter, r *http.Request) {
 		id, _ := strconv.ParseUint(mux.Vars(r)["id"], 10, 64)
-		res, _ := p.Repeat(id)
-		_ = json.NewEncoder(w).Encode(res)
+		res, err := p.Repeat(id)
+		if errors.Is(err, scanner.ErrOutOfScope) {
+			writeError(w, http.StatusForbidden, err)
+			return
+		}
+		if errors.Is(err, scanner.ErrTruncated) {
+			writeError(w, http.StatusConflict, err)
+			return
+		}
+		if errors.Is(err, store.ErrNotFound) {
+			writeError(w, http.StatusNotFound, err)
+			return
+		}
+		if err != nil {
+			// запись не разбирается или сервер не ответил
+			writeError(w, http.StatusBadGateway, err)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(encodeResponse(res))
 	}).Methods(http.MethodPost)
 
 	r.HandleFunc("/scan/{id}", func(w http.ResponseWriter, r *http.Request) {
 		id, _ := strconv.ParseUint(mux.Vars(r)["id"], 10, 64)
-		res, _ := p.DirBuster(id)
+		res, err := p.DirBuster(id)
+		if errors.Is(err, scanner.ErrOutOfScope) {
+			writeError(w, http.StatusForbidden, err)
+			return
+		}
+		if errors.Is(err, store.ErrNotFound) {
+			writeError(w, http.StatusNotFound, err)
+			return
+		}
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
 		_ = json.NewEncoder(w).Encode(res)
 	}).Methods(http.MethodPost)
 
-	http.ListenAndServe(":8000", r)
+	r.HandleFunc("/upstream/stats", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(t.Stats())
+	}).Methods(http.MethodGet)
+
+	r.HandleFunc("/certs/stats", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(d.CertCache.Stats())
+	}).Methods(http.MethodGet)
+
+	// сбрасывает кеш сертификатов в памяти и в постоянном хранилище
+	r.HandleFunc("/certs/flush", func(w http.ResponseWriter, r *http.Request) {
+		if err := d.CertCache.Flush(); err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}).Methods(http.MethodPost)
+
+	registerCA(r, d.CA)
+	registerIntercept(r, d.Intercept)
+	registerRewrite(r, d.Rewrite)
+	registerScope(r, d.Scope)
+	registerPassthrough(r, d.Passthrough)
+	registerWebSocket(r, s, p, d.WebSockets)
+	registerSSE(r, s)
+
+	if err := http.ListenAndServe(addr, r); err != nil {
+		log.Fatalf("api: %v", err)
+	}
+}
+
+// writeError отвечает JSON-объектом {"error": "..."} с указанным кодом.
+func writeError(w http.ResponseWriter, code int, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
 }
@@ -0,0 +1,52 @@
+package api
+
+import (
+	"encoding/base64"
+
+	"github.com/goriiin/go-proxy/internal/domain"
+)
+
+// bodyBase64 — значение body_encoding у тела, переданного в base64.
+const bodyBase64 = "base64"
+
+// encodeBodies готовит тела записи к JSON: текст отдаётся строкой, тело
+// с body_binary — в base64 с body_encoding: "base64". У записей, сохранённых
+// до появления двоичных тел, body — уже строка и не меняется; пустое тело
+// (nil в msgpack) отдаётся пустой строкой.
+func encodeBodies(item map[string]interface{}) map[string]interface{} {
+	data, _ := item["data"].(map[string]interface{})
+	for _, part := range []string{"request", "response"} {
+		m, _ := data[part].(map[string]interface{})
+		body, ok := m["body"].([]byte)
+		if m == nil || !ok && m["body"] != nil {
+			continue
+		}
+		if binary, _ := m["body_binary"].(bool); binary {
+			m["body"] = base64.StdEncoding.EncodeToString(body)
+			m["body_encoding"] = bodyBase64
+		} else {
+			m["body"] = string(body)
+		}
+	}
+
+	return item
+}
+
+// responseJSON — ответ повтора: поля ParsedResponse, но Body — строка,
+// двоичное тело — в base64 с BodyEncoding = "base64".
+type responseJSON struct {
+	*domain.ParsedResponse
+	Body         string
+	BodyEncoding string `json:",omitempty"`
+}
+
+func encodeResponse(resp *domain.ParsedResponse) *responseJSON {
+	if resp == nil {
+		return nil
+	}
+	if resp.BodyBinary {
+		return &responseJSON{ParsedResponse: resp, Body: base64.StdEncoding.EncodeToString(resp.Body), BodyEncoding: bodyBase64}
+	}
+
+	return &responseJSON{ParsedResponse: resp, Body: string(resp.Body)}
+}
@@ -0,0 +1,37 @@
+package api
+
+import (
+	"crypto/x509"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+
+	"github.com/goriiin/go-proxy/internal/ca"
+)
+
+// registerCA — скачивание сертификата CA для установки на устройства:
+// /ca — страница со ссылками, /ca/ca.pem, /ca/ca.der, /ca/ca.p12?password=...
+func registerCA(r *mux.Router, cert *x509.Certificate) {
+	r.HandleFunc("/ca", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		_, _ = w.Write([]byte(ca.IndexPage(cert, "/ca/")))
+	}).Methods(http.MethodGet)
+
+	r.HandleFunc("/ca/{file}", func(w http.ResponseWriter, r *http.Request) {
+		format, ok := strings.CutPrefix(mux.Vars(r)["file"], "ca.")
+		if !ok {
+			writeError(w, http.StatusNotFound, errors.New("unknown file"))
+			return
+		}
+		data, contentType, filename, err := ca.Export(cert, format, r.URL.Query().Get("password"))
+		if err != nil {
+			writeError(w, http.StatusNotFound, err)
+			return
+		}
+		w.Header().Set("Content-Type", contentType)
+		w.Header().Set("Content-Disposition", "attachment; filename=\""+filename+"\"")
+		_, _ = w.Write(data)
+	}).Methods(http.MethodGet)
+}
@@ -0,0 +1,64 @@
+package api
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// filterTLS оставляет записи, у которых параметры TLS совпадают с
+// запросом вида ?tls.client.ja4=...&tls.upstream.version=TLS 1.3.
+// Путь после "tls." ведёт по полям meta.tls; для списков (offered_ciphers,
+// chain.…) достаточно совпадения одного элемента. Сравнение без учёта регистра.
+func filterTLS(list []map[string]interface{}, q url.Values) []map[string]interface{} {
+	filters := map[string]string{}
+	for k, v := range q {
+		if strings.HasPrefix(k, "tls.") && len(v) > 0 {
+			filters[strings.TrimPrefix(k, "tls.")] = v[0]
+		}
+	}
+	if len(filters) == 0 {
+		return list
+	}
+
+	out := make([]map[string]interface{}, 0, len(list))
+	for _, item := range list {
+		data, _ := item["data"].(map[string]interface{})
+		meta, _ := data["meta"].(map[string]interface{})
+		tls := meta["tls"]
+
+		ok := true
+		for field, want := range filters {
+			if !matchField(tls, strings.Split(field, "."), want) {
+				ok = false
+				break
+			}
+		}
+		if ok {
+			out = append(out, item)
+		}
+	}
+
+	return out
+}
+
+func matchField(v interface{}, path []string, want string) bool {
+	switch x := v.(type) {
+	case map[string]interface{}:
+		if len(path) == 0 {
+			return false
+		}
+		return matchField(x[path[0]], path[1:], want)
+	case []interface{}:
+		for _, el := range x {
+			if matchField(el, path, want) {
+				return true
+			}
+		}
+		return false
+	case nil:
+		return false
+	}
+
+	return len(path) == 0 && strings.EqualFold(fmt.Sprint(v), want)
+}
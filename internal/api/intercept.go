@@ -0,0 +1,80 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"github.com/goriiin/go-proxy/internal/intercept"
+)
+
+// registerIntercept — правила точек останова и очередь перехваченных
+// запросов/ответов (аналог вкладки Intercept в Burp).
+func registerIntercept(r *mux.Router, ic *intercept.Interceptor) {
+	r.HandleFunc("/intercept/rules", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(ic.Rules())
+	}).Methods(http.MethodGet)
+
+	r.HandleFunc("/intercept/rules", func(w http.ResponseWriter, r *http.Request) {
+		rule := intercept.Rule{Enable: true}
+		if err := json.NewDecoder(r.Body).Decode(&rule); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		rule, err := ic.AddRule(rule)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+		_ = json.NewEncoder(w).Encode(rule)
+	}).Methods(http.MethodPost)
+
+	r.HandleFunc("/intercept/rules/{id}", func(w http.ResponseWriter, r *http.Request) {
+		if !ic.DeleteRule(mux.Vars(r)["id"]) {
+			writeError(w, http.StatusNotFound, errors.New("rule not found"))
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}).Methods(http.MethodDelete)
+
+	r.HandleFunc("/intercept/queue", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(ic.Pending())
+	}).Methods(http.MethodGet)
+
+	r.HandleFunc("/intercept/queue/{id}", func(w http.ResponseWriter, r *http.Request) {
+		item, ok := ic.Get(mux.Vars(r)["id"])
+		if !ok {
+			writeError(w, http.StatusNotFound, errors.New("item not found"))
+			return
+		}
+		_ = json.NewEncoder(w).Encode(item)
+	}).Methods(http.MethodGet)
+
+	// тело — необязательный {"raw": "..."} с отредактированным запросом/ответом
+	r.HandleFunc("/intercept/queue/{id}/forward", func(w http.ResponseWriter, r *http.Request) {
+		d := intercept.Decision{Action: intercept.ActionForward}
+		if r.ContentLength != 0 {
+			if err := json.NewDecoder(r.Body).Decode(&d); err != nil {
+				writeError(w, http.StatusBadRequest, err)
+				return
+			}
+			d.Action = intercept.ActionForward
+		}
+		resolve(w, ic, mux.Vars(r)["id"], d)
+	}).Methods(http.MethodPost)
+
+	r.HandleFunc("/intercept/queue/{id}/drop", func(w http.ResponseWriter, r *http.Request) {
+		resolve(w, ic, mux.Vars(r)["id"], intercept.Decision{Action: intercept.ActionDrop})
+	}).Methods(http.MethodPost)
+}
+
+func resolve(w http.ResponseWriter, ic *intercept.Interceptor, id string, d intercept.Decision) {
+	if err := ic.Resolve(id, d); err != nil {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
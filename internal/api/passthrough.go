@@ -0,0 +1,47 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"github.com/goriiin/go-proxy/internal/proxy"
+)
+
+// registerPassthrough — хосты, TLS которых прокси не расшифровывает.
+func registerPassthrough(r *mux.Router, pt *proxy.Passthrough) {
+	r.HandleFunc("/passthrough", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(pt.List())
+	}).Methods(http.MethodGet)
+
+	r.HandleFunc("/passthrough", func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Host string `json:"host"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		if err := pt.Add(body.Host); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+		_ = json.NewEncoder(w).Encode(pt.List())
+	}).Methods(http.MethodPost)
+
+	// снова расшифровывать всё, что прокси пропустил сам после отказов от сертификата
+	r.HandleFunc("/passthrough/auto", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]int{"removed": pt.ClearAuto()})
+	}).Methods(http.MethodDelete)
+
+	r.HandleFunc("/passthrough/{host}", func(w http.ResponseWriter, r *http.Request) {
+		if !pt.Remove(mux.Vars(r)["host"]) {
+			writeError(w, http.StatusNotFound, errors.New("host not found"))
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}).Methods(http.MethodDelete)
+}
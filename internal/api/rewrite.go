@@ -0,0 +1,63 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"github.com/goriiin/go-proxy/internal/domain"
+	"github.com/goriiin/go-proxy/internal/rewrite"
+)
+
+// registerRewrite — правила Match & Replace (аналог одноимённой вкладки в Burp).
+func registerRewrite(r *mux.Router, e *rewrite.Engine) {
+	r.HandleFunc("/rewrite/rules", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(e.Rules())
+	}).Methods(http.MethodGet)
+
+	r.HandleFunc("/rewrite/rules", func(w http.ResponseWriter, r *http.Request) {
+		rule := domain.RewriteRule{Enabled: true}
+		if err := json.NewDecoder(r.Body).Decode(&rule); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		rule.ID = ""
+		rule, err := e.Put(rule)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+		_ = json.NewEncoder(w).Encode(rule)
+	}).Methods(http.MethodPost)
+
+	r.HandleFunc("/rewrite/rules/{id}", func(w http.ResponseWriter, r *http.Request) {
+		rule := domain.RewriteRule{Enabled: true}
+		if err := json.NewDecoder(r.Body).Decode(&rule); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		rule.ID = mux.Vars(r)["id"]
+		rule, err := e.Put(rule)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(rule)
+	}).Methods(http.MethodPut)
+
+	r.HandleFunc("/rewrite/rules/{id}", func(w http.ResponseWriter, r *http.Request) {
+		ok, err := e.Delete(mux.Vars(r)["id"])
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		if !ok {
+			writeError(w, http.StatusNotFound, errors.New("rule not found"))
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}).Methods(http.MethodDelete)
+}
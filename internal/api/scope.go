@@ -0,0 +1,50 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"github.com/goriiin/go-proxy/internal/scope"
+)
+
+// registerScope — просмотр и замена scope целиком.
+func registerScope(r *mux.Router, sp *scope.Scope) {
+	r.HandleFunc("/scope", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(sp.Config())
+	}).Methods(http.MethodGet)
+
+	r.HandleFunc("/scope", func(w http.ResponseWriter, r *http.Request) {
+		var cfg scope.Config
+		if err := json.NewDecoder(r.Body).Decode(&cfg); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		if err := sp.Set(cfg); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(sp.Config())
+	}).Methods(http.MethodPut)
+}
+
+// filterScope оставляет записи истории, попадающие в scope.
+func filterScope(list []map[string]interface{}, sp *scope.Scope) []map[string]interface{} {
+	out := make([]map[string]interface{}, 0, len(list))
+	for _, item := range list {
+		host, _ := item["host"].(string)
+		data, _ := item["data"].(map[string]interface{})
+		req, _ := data["request"].(map[string]interface{})
+		scheme, _ := req["scheme"].(string)
+		path, _ := req["path"].(string)
+		if scheme == "" {
+			scheme = "http"
+		}
+		if sp.Contains(scheme, host, path) {
+			out = append(out, item)
+		}
+	}
+
+	return out
+}
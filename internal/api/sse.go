@@ -0,0 +1,28 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+
+	"github.com/goriiin/go-proxy/internal/store"
+)
+
+// registerSSE — события Server-Sent Events из ответа на запрос {id} в порядке прихода.
+func registerSSE(r *mux.Router, s *store.Store) {
+	r.HandleFunc("/requests/{id}/sse", func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 64)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		events, err := s.SSEEvents(id)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(events)
+	}).Methods(http.MethodGet)
+}
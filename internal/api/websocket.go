@@ -0,0 +1,106 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+
+	"github.com/goriiin/go-proxy/internal/domain"
+	"github.com/goriiin/go-proxy/internal/proxy"
+	"github.com/goriiin/go-proxy/internal/scanner"
+	"github.com/goriiin/go-proxy/internal/store"
+	"github.com/goriiin/go-proxy/internal/websocket"
+)
+
+// registerWebSocket — сообщения WebSocket, перехваченные после рукопожатия {id},
+// повтор соединения по сохранённому рукопожатию и отправка сообщений в открытые.
+func registerWebSocket(r *mux.Router, s *store.Store, sc *scanner.Scanner, live *proxy.WebSockets) {
+	r.HandleFunc("/requests/{id}/ws", func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 64)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		msgs, err := s.WSMessages(id)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(msgs)
+	}).Methods(http.MethodGet)
+
+	// тело — scanner.WSRepeat: {"messages": [{"replay": 0, "payload": "...", "fuzz": [...]}], "wait_ms": 2000}
+	r.HandleFunc("/repeat/{id}/ws", func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 64)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		var req scanner.WSRepeat
+		if err = json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		res, err := sc.RepeatWS(id, req)
+		switch {
+		case errors.Is(err, scanner.ErrOutOfScope):
+			writeError(w, http.StatusForbidden, err)
+			return
+		case err != nil:
+			writeError(w, http.StatusBadGateway, err)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(res)
+	}).Methods(http.MethodPost)
+
+	r.HandleFunc("/ws/live", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(live.List())
+	}).Methods(http.MethodGet)
+
+	// тело: {"direction": "client"|"server", "opcode": 1, "payload": "...", "encoding": "base64"}
+	r.HandleFunc("/ws/live/{id}", func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 64)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		var msg struct {
+			Direction string `json:"direction"`
+			Opcode    int    `json:"opcode"`
+			Payload   string `json:"payload"`
+			Encoding  string `json:"encoding"`
+		}
+		if err = json.NewDecoder(r.Body).Decode(&msg); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		if msg.Direction == "" {
+			msg.Direction = domain.WSFromClient
+		}
+		if msg.Opcode == 0 {
+			msg.Opcode = websocket.OpText
+		}
+		payload, err := websocket.Decode(msg.Payload, msg.Encoding)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+
+		err = live.Send(id, msg.Direction, byte(msg.Opcode), payload)
+		switch {
+		case errors.Is(err, proxy.ErrNoSession):
+			writeError(w, http.StatusNotFound, err)
+			return
+		case errors.Is(err, proxy.ErrFragmented):
+			writeError(w, http.StatusConflict, err)
+			return
+		case err != nil:
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}).Methods(http.MethodPost)
+}
@@ -0,0 +1,140 @@
+package ca
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"time"
+)
+
+// Типы ключей для CA и поддельных сертификатов.
+const (
+	KeyRSA2048   = "rsa2048"
+	KeyECDSAP256 = "ecdsa-p256"
+	KeyEd25519   = "ed25519"
+)
+
+// GenerateKey создаёт закрытый ключ указанного типа.
+func GenerateKey(keyType string) (crypto.Signer, error) {
+	switch keyType {
+	case KeyRSA2048:
+		return rsa.GenerateKey(rand.Reader, 2048)
+	case KeyECDSAP256:
+		return ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case KeyEd25519:
+		_, key, err := ed25519.GenerateKey(rand.Reader)
+		return key, err
+	}
+
+	return nil, fmt.Errorf("unknown key type %q", keyType)
+}
+
+// Options — параметры нового корневого сертификата.
+type Options struct {
+	KeyType      string
+	Validity     time.Duration
+	CommonName   string
+	Organization string
+	// Parent — CA, которым подписывается новый промежуточный; nil — самоподписанный корень.
+	Parent *tls.Certificate
+}
+
+// Create выпускает CA и возвращает сертификат и ключ (PKCS#8) в PEM.
+// Для промежуточного CA в PEM сертификата следом идёт цепочка родителя.
+func Create(opts Options) (certPEM, keyPEM []byte, err error) {
+	key, err := GenerateKey(opts.KeyType)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to generate serial number: %w", err)
+	}
+	pubDER, err := x509.MarshalPKIXPublicKey(key.Public())
+	if err != nil {
+		return nil, nil, err
+	}
+	keyID := sha1.Sum(pubDER)
+
+	subject := pkix.Name{CommonName: opts.CommonName}
+	if opts.Organization != "" {
+		subject.Organization = []string{opts.Organization}
+	}
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               subject,
+		NotBefore:             time.Now().Add(-1 * time.Hour),
+		NotAfter:              time.Now().Add(opts.Validity),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		SubjectKeyId:          keyID[:],
+	}
+
+	issuer, signer := template, crypto.Signer(key)
+	if opts.Parent != nil {
+		var ok bool
+		if signer, ok = opts.Parent.PrivateKey.(crypto.Signer); !ok {
+			return nil, nil, fmt.Errorf("parent CA key %T cannot sign", opts.Parent.PrivateKey)
+		}
+		issuer = opts.Parent.Leaf
+		// промежуточный CA подписывает только листья и живёт не дольше родителя
+		template.MaxPathLenZero = true
+		if template.NotAfter.After(issuer.NotAfter) {
+			template.NotAfter = issuer.NotAfter
+		}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, issuer, key.Public(), signer)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create CA certificate: %w", err)
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	certPEM = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	if opts.Parent != nil {
+		for _, parentDER := range opts.Parent.Certificate {
+			certPEM = append(certPEM, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: parentDER})...)
+		}
+	}
+
+	return certPEM, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}), nil
+}
+
+// WriteFiles создаёт CA и записывает его в certFile и keyFile.
+// Существующие файлы не перезаписываются.
+func WriteFiles(certFile, keyFile string, opts Options) error {
+	for _, f := range []string{certFile, keyFile} {
+		if _, err := os.Stat(f); err == nil {
+			return fmt.Errorf("%s already exists", f)
+		} else if !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+
+	certPEM, keyPEM, err := Create(opts)
+	if err != nil {
+		return err
+	}
+	if err = os.WriteFile(keyFile, keyPEM, 0o600); err != nil {
+		return err
+	}
+
+	return os.WriteFile(certFile, certPEM, 0o644)
+}
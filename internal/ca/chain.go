@@ -0,0 +1,76 @@
+package ca
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// SplitChain разбирает цепочку из -ca-cert: первым идёт сертификат,
+// которым подписываются поддельные. Возвращает промежуточные сертификаты,
+// которые клиент должен получить вместе с листом, и якорь доверия —
+// самоподписанный корень в конце цепочки, который устанавливают на
+// устройства. Цепочка, которая не доходит до корня, — ошибка: выдать
+// устройству промежуточный сертификат вместо корня значило бы сломать
+// доверие на клиентах, которые проверяют цепочку до самоподписанного.
+func SplitChain(chain [][]byte) ([][]byte, *x509.Certificate, error) {
+	if len(chain) == 0 {
+		return nil, nil, errors.New("empty CA chain")
+	}
+
+	var intermediates [][]byte
+	var anchor *x509.Certificate
+	for i, der := range chain {
+		cert, err := x509.ParseCertificate(der)
+		if err != nil {
+			return nil, nil, fmt.Errorf("CA chain certificate %d: %w", i, err)
+		}
+		if !cert.IsCA {
+			return nil, nil, fmt.Errorf("CA chain certificate %d (%s) is not a CA", i, cert.Subject)
+		}
+		if i > 0 && anchor.CheckSignatureFrom(cert) != nil {
+			return nil, nil, fmt.Errorf("CA chain certificate %d (%s) did not issue %s", i, cert.Subject, anchor.Subject)
+		}
+		if !selfSigned(cert) {
+			intermediates = append(intermediates, der)
+		}
+		anchor = cert
+	}
+	if !selfSigned(anchor) {
+		return nil, nil, fmt.Errorf("CA chain ends with %s, which is not self-signed; add the root issued by %s with -ca-chain", anchor.Subject, anchor.Issuer)
+	}
+
+	return intermediates, anchor, nil
+}
+
+func selfSigned(cert *x509.Certificate) bool {
+	return bytes.Equal(cert.RawSubject, cert.RawIssuer) && cert.CheckSignatureFrom(cert) == nil
+}
+
+// ReadChain читает все сертификаты из PEM-файла.
+func ReadChain(file string) ([][]byte, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	var chain [][]byte
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		if block.Type == "CERTIFICATE" {
+			chain = append(chain, block.Bytes)
+		}
+	}
+	if len(chain) == 0 {
+		return nil, fmt.Errorf("%s: no certificates found", file)
+	}
+
+	return chain, nil
+}
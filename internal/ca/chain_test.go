@@ -0,0 +1,68 @@
+package ca
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"testing"
+	"time"
+)
+
+// issue выпускает CA, подписанный parent (nil — самоподписанный корень).
+// В Certificate — сам CA, затем цепочка родителя.
+func issue(t *testing.T, name string, parent *tls.Certificate) *tls.Certificate {
+	t.Helper()
+
+	certPEM, keyPEM, err := Create(Options{CommonName: name, KeyType: KeyECDSAP256, Validity: time.Hour, Parent: parent})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cert.Leaf == nil {
+		cert.Leaf, _ = x509.ParseCertificate(cert.Certificate[0])
+	}
+
+	return &cert
+}
+
+func TestSplitChain(t *testing.T) {
+	root := issue(t, "root", nil)
+	inter := issue(t, "intermediate", root)
+	signing := issue(t, "signing", inter)
+	other := issue(t, "other root", nil)
+
+	tests := []struct {
+		name       string
+		chain      [][]byte
+		wantInter  int
+		wantAnchor string
+		wantErr    bool
+	}{
+		{"root only", root.Certificate, 0, "root", false},
+		{"intermediate and root", inter.Certificate, 1, "root", false},
+		{"two intermediates and root", signing.Certificate, 2, "root", false},
+		{"intermediate without root", inter.Certificate[:1], 0, "", true},
+		{"chain cut before root", signing.Certificate[:2], 0, "", true},
+		{"wrong issuer", [][]byte{inter.Certificate[0], other.Certificate[0]}, 0, "", true},
+		{"wrong order", [][]byte{root.Certificate[0], inter.Certificate[0]}, 0, "", true},
+		{"garbage", [][]byte{[]byte("not der")}, 0, "", true},
+		{"empty", nil, 0, "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			intermediates, anchor, err := SplitChain(tt.chain)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if len(intermediates) != tt.wantInter || anchor.Subject.CommonName != tt.wantAnchor {
+				t.Errorf("got %d intermediates, anchor %q, want %d, %q", len(intermediates), anchor.Subject.CommonName, tt.wantInter, tt.wantAnchor)
+			}
+		})
+	}
+}
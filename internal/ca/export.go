@@ -0,0 +1,46 @@
+package ca
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"html"
+	"strings"
+
+	"software.sslmate.com/src/go-pkcs12"
+)
+
+// Export кодирует сертификат CA для установки на устройство: pem (или crt),
+// der (или cer) и p12. Возвращает данные, Content-Type и имя файла.
+func Export(cert *x509.Certificate, format, password string) ([]byte, string, string, error) {
+	switch strings.ToLower(format) {
+	case "", "pem", "crt":
+		data := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})
+		return data, "application/x-x509-ca-cert", "go-proxy-ca.crt", nil
+	case "der", "cer":
+		return cert.Raw, "application/pkix-cert", "go-proxy-ca.cer", nil
+	case "p12", "pfx":
+		// Legacy-шифрование понимают старые Android и Windows
+		data, err := pkcs12.Legacy.EncodeTrustStore([]*x509.Certificate{cert}, password)
+		if err != nil {
+			return nil, "", "", err
+		}
+		return data, "application/x-pkcs12", "go-proxy-ca.p12", nil
+	}
+
+	return nil, "", "", fmt.Errorf("unknown certificate format %q", format)
+}
+
+// IndexPage — страница со ссылками на CA во всех форматах; prefix
+// добавляется перед именами файлов.
+func IndexPage(cert *x509.Certificate, prefix string) string {
+	var b strings.Builder
+	b.WriteString("<!DOCTYPE html><html><head><meta charset=\"utf-8\"><title>go-proxy CA</title></head><body>\n")
+	b.WriteString("<h1>go-proxy CA</h1>\n<p>" + html.EscapeString(cert.Subject.String()) + "</p>\n<ul>\n")
+	for _, f := range []string{"pem", "der", "p12"} {
+		fmt.Fprintf(&b, "<li><a href=\"%sca.%s\">ca.%s</a></li>\n", prefix, f, f)
+	}
+	b.WriteString("</ul>\n</body></html>\n")
+
+	return b.String()
+}
@@ -0,0 +1,248 @@
+package certcache
+
+import (
+	"container/list"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/goriiin/go-proxy/internal/errs"
+)
+
+// Backend — постоянное хранилище сертификатов, чтобы после перезапуска
+// не выпускать их заново. LoadCert возвращает nil, nil, если записи нет.
+// Ключ — не просто имя хоста: вызывающий добавляет к нему профиль выпуска
+// (CA и параметры), чтобы не получить лист, подписанный другим CA.
+type Backend interface {
+	LoadCert(host string) ([]byte, error)
+	SaveCert(host string, data []byte) error
+	ClearCerts() error
+}
+
+// Stats — счётчики кеша для API.
+type Stats struct {
+	Size        int    `json:"size"`
+	MaxSize     int    `json:"max_size"`
+	Hits        uint64 `json:"hits"`
+	Misses      uint64 `json:"misses"`
+	BackendHits uint64 `json:"backend_hits"`
+	Generated   uint64 `json:"generated"`
+	Evictions   uint64 `json:"evictions"`
+	Persistent  bool   `json:"persistent"`
+}
+
+type entry struct {
+	host string
+	cert *tls.Certificate
+}
+
+// call — выпуск сертификата, которого ждут все запросившие тот же хост.
+type call struct {
+	wg   sync.WaitGroup
+	cert *tls.Certificate
+	err  error
+}
+
+// Cache — LRU-кеш поддельных сертификатов ограниченного размера.
+// Сертификат для одного хоста выпускается один раз, даже если его
+// одновременно запросили несколько соединений.
+type Cache struct {
+	max     int
+	backend Backend
+
+	mu       sync.Mutex
+	order    *list.List // от недавно использованных к давним
+	items    map[string]*list.Element
+	inflight map[string]*call
+	stats    Stats
+}
+
+// New создаёт кеш на max сертификатов; backend может быть nil.
+func New(max int, backend Backend) *Cache {
+	return &Cache{
+		max:      max,
+		backend:  backend,
+		order:    list.New(),
+		items:    map[string]*list.Element{},
+		inflight: map[string]*call{},
+	}
+}
+
+// Get возвращает действующий сертификат из памяти: errs.NoCert, если его
+// нет, и errs.DeprecatedCert, если срок истёк (запись при этом удаляется).
+func (c *Cache) Get(host string) (*tls.Certificate, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.items[host]
+	if !ok {
+		return nil, errs.NoCert
+	}
+	cert := el.Value.(*entry).cert
+	if !valid(cert) {
+		log.Printf("certificate expired at %v for %s", cert.Leaf.NotAfter, host)
+		c.order.Remove(el)
+		delete(c.items, host)
+		return nil, errs.DeprecatedCert
+	}
+	c.order.MoveToFront(el)
+	c.stats.Hits++
+
+	return cert, nil
+}
+
+// GetOrCreate ищет сертификат в памяти, затем в постоянном хранилище и
+// только потом выпускает его через create.
+func (c *Cache) GetOrCreate(host string, create func() (*tls.Certificate, error)) (*tls.Certificate, error) {
+	if cert, err := c.Get(host); err == nil {
+		log.Printf("Using cached certificate for %s", host)
+		return cert, nil
+	}
+
+	c.mu.Lock()
+	if cl, ok := c.inflight[host]; ok {
+		c.mu.Unlock()
+		cl.wg.Wait()
+		return cl.cert, cl.err
+	}
+	cl := &call{}
+	cl.wg.Add(1)
+	c.inflight[host] = cl
+	c.stats.Misses++
+	c.mu.Unlock()
+
+	cl.cert, cl.err = c.load(host, create)
+
+	c.mu.Lock()
+	delete(c.inflight, host)
+	if cl.err == nil {
+		c.add(host, cl.cert)
+	}
+	c.mu.Unlock()
+	cl.wg.Done()
+
+	return cl.cert, cl.err
+}
+
+func (c *Cache) load(host string, create func() (*tls.Certificate, error)) (*tls.Certificate, error) {
+	if c.backend != nil {
+		data, err := c.backend.LoadCert(host)
+		if err != nil {
+			log.Printf("Failed to load stored certificate for %s: %v", host, err)
+		}
+		if data != nil {
+			cert, err := decode(data)
+			if err == nil && valid(cert) {
+				c.mu.Lock()
+				c.stats.BackendHits++
+				c.mu.Unlock()
+				log.Printf("Using stored certificate for %s", host)
+				return cert, nil
+			}
+			if err != nil {
+				log.Printf("Stored certificate for %s is broken: %v", host, err)
+			}
+		}
+	}
+
+	cert, err := create()
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	c.stats.Generated++
+	c.mu.Unlock()
+
+	if c.backend != nil {
+		data, err := encode(cert)
+		if err == nil {
+			err = c.backend.SaveCert(host, data)
+		}
+		if err != nil {
+			log.Printf("Failed to store certificate for %s: %v", host, err)
+		}
+	}
+
+	return cert, nil
+}
+
+// add кладёт сертификат в начало списка и вытесняет самые давние; c.mu захвачен.
+func (c *Cache) add(host string, cert *tls.Certificate) {
+	if el, ok := c.items[host]; ok {
+		el.Value.(*entry).cert = cert
+		c.order.MoveToFront(el)
+		return
+	}
+	c.items[host] = c.order.PushFront(&entry{host: host, cert: cert})
+
+	for c.max > 0 && c.order.Len() > c.max {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.items, oldest.Value.(*entry).host)
+		c.stats.Evictions++
+	}
+}
+
+// Stats возвращает текущие счётчики.
+func (c *Cache) Stats() Stats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	st := c.stats
+	st.Size = c.order.Len()
+	st.MaxSize = c.max
+	st.Persistent = c.backend != nil
+
+	return st
+}
+
+// Flush очищает кеш в памяти и постоянное хранилище.
+func (c *Cache) Flush() error {
+	c.mu.Lock()
+	c.order.Init()
+	c.items = map[string]*list.Element{}
+	c.mu.Unlock()
+
+	if c.backend == nil {
+		return nil
+	}
+
+	return c.backend.ClearCerts()
+}
+
+func valid(cert *tls.Certificate) bool {
+	return cert.Leaf != nil && time.Now().Before(cert.Leaf.NotAfter)
+}
+
+// encode сохраняет цепочку и ключ одним PEM-блоком текста.
+func encode(cert *tls.Certificate) ([]byte, error) {
+	key, err := x509.MarshalPKCS8PrivateKey(cert.PrivateKey)
+	if err != nil {
+		return nil, fmt.Errorf("marshal key: %w", err)
+	}
+
+	var out []byte
+	for _, der := range cert.Certificate {
+		out = append(out, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})...)
+	}
+
+	return append(out, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: key})...), nil
+}
+
+func decode(data []byte) (*tls.Certificate, error) {
+	cert, err := tls.X509KeyPair(data, data)
+	if err != nil {
+		return nil, err
+	}
+	if cert.Leaf == nil {
+		if cert.Leaf, err = x509.ParseCertificate(cert.Certificate[0]); err != nil {
+			return nil, err
+		}
+	}
+
+	return &cert, nil
+}
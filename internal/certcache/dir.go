@@ -0,0 +1,54 @@
+package certcache
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Dir хранит сертификаты файлами <host>.pem в каталоге.
+type Dir string
+
+// NewDir создаёт каталог, если его ещё нет.
+func NewDir(path string) (Dir, error) {
+	if err := os.MkdirAll(path, 0o700); err != nil {
+		return "", err
+	}
+
+	return Dir(path), nil
+}
+
+func (d Dir) file(host string) string {
+	// ':' из IPv6 и '*' недопустимы в именах файлов на части систем
+	name := strings.NewReplacer(":", "_", "*", "_wildcard_", "/", "_").Replace(host)
+
+	return filepath.Join(string(d), name+".pem")
+}
+
+func (d Dir) LoadCert(host string) ([]byte, error) {
+	data, err := os.ReadFile(d.file(host))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+
+	return data, err
+}
+
+func (d Dir) SaveCert(host string, data []byte) error {
+	return os.WriteFile(d.file(host), data, 0o600)
+}
+
+func (d Dir) ClearCerts() error {
+	files, err := filepath.Glob(filepath.Join(string(d), "*.pem"))
+	if err != nil {
+		return err
+	}
+	for _, f := range files {
+		if err = os.Remove(f); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
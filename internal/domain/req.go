@@ -1,5 +1,7 @@
 package domain
 
+import "unicode/utf8"
+
 type ParsedRequest struct {
 	Method     string                 `msgpack:"method"`
 	Path       string                 `msgpack:"path"`
@@ -7,14 +9,158 @@ type ParsedRequest struct {
 	Headers    map[string]string      `msgpack:"headers"`
 	Cookies    map[string]string      `msgpack:"cookies"`
 	PostParams map[string]interface{} `msgpack:"post_params"`
-	Body       string                 `msgpack:"body"`
-	Host       string                 `msgpack:"host"`
-	RawRequest string                 `msgpack:"raw_request"`
+	// Body — байты тела в том виде, как они ушли на сервер (msgpack bin).
+	Body []byte `msgpack:"body"`
+	// BodyBinary — тело не текст в UTF-8; API отдаёт такое тело в base64.
+	BodyBinary  bool   `msgpack:"body_binary"`
+	ContentType string `msgpack:"content_type"`
+	// BodySize и BodySHA256 — по полному телу; в Body сохраняется не больше
+	// лимита, и тогда BodyTruncated = true.
+	BodySize      int64  `msgpack:"body_size"`
+	BodySHA256    string `msgpack:"body_sha256"`
+	BodyTruncated bool   `msgpack:"body_truncated"`
+	// BodyIncomplete — тело оборвалось раньше конца (соединение закрыли
+	// до EOF); BodySize и BodySHA256 тогда — по полученной части.
+	BodyIncomplete bool   `msgpack:"body_incomplete"`
+	Host           string `msgpack:"host"`
+	// Target — адрес, с которым соединился прокси, и ServerName — имя,
+	// которым он представился серверу в TLS. В прозрачном режиме и при
+	// CONNECT к IP они не совпадают с Host; пустой ServerName — имя из Target.
+	Target     string `msgpack:"target,omitempty"`
+	ServerName string `msgpack:"server_name,omitempty"`
+	Scheme     string `msgpack:"scheme"`
+	// RawRequest — текст запроса; двоичное тело в него не входит, оно только в Body.
+	RawRequest string `msgpack:"raw_request"`
 }
 
 type ParsedResponse struct {
 	Code    int               `msgpack:"code"`
 	Message string            `msgpack:"message"`
 	Headers map[string]string `msgpack:"headers"`
-	Body    string            `msgpack:"body"`
+	Body    []byte            `msgpack:"body"` // после gzip-распаковки
+	// BodyBinary — тело не текст в UTF-8; API отдаёт такое тело в base64.
+	BodyBinary  bool   `msgpack:"body_binary"`
+	ContentType string `msgpack:"content_type"`
+	// BodySize и BodySHA256 — по телу в том виде, как его прислал сервер.
+	BodySize      int64  `msgpack:"body_size"`
+	BodySHA256    string `msgpack:"body_sha256"`
+	BodyTruncated bool   `msgpack:"body_truncated"`
+	// BodyIncomplete — клиент или сервер закрыл соединение, не дойдя до конца тела.
+	BodyIncomplete bool `msgpack:"body_incomplete"`
+}
+
+// IsBinary — тело не текст в UTF-8. У обрезанного тела граница могла
+// разрезать последний символ, поэтому неполная последовательность в самом
+// конце двоичным тело не делает.
+func IsBinary(body []byte, truncated bool) bool {
+	if truncated {
+		for i := len(body) - 1; i >= 0 && i >= len(body)-utf8.UTFMax+1; i-- {
+			if utf8.RuneStart(body[i]) {
+				if !utf8.FullRune(body[i:]) {
+					body = body[:i]
+				}
+				break
+			}
+		}
+	}
+
+	return !utf8.Valid(body)
+}
+
+// Meta — сведения об обмене, не относящиеся к самим запросу и ответу.
+type Meta struct {
+	User  string   `msgpack:"user"`
+	Rules []string `msgpack:"rules"` // ID сработавших правил Match & Replace
+	TLS   *TLSInfo `msgpack:"tls,omitempty"`
+	// Proto — протокол клиента: HTTP/1.1 или HTTP/2.0.
+	Proto string `msgpack:"proto,omitempty"`
+	// StreamID — номер потока HTTP/2, в котором пришёл запрос.
+	StreamID uint32 `msgpack:"stream_id,omitempty"`
+	// RepeatOf — id записи, повтором которой получен этот обмен.
+	RepeatOf uint64 `msgpack:"repeat_of,omitempty"`
+}
+
+// TLSInfo — параметры TLS обеих сторон обмена через MITM.
+type TLSInfo struct {
+	Client   *ClientTLS   `msgpack:"client,omitempty"`
+	Upstream *UpstreamTLS `msgpack:"upstream,omitempty"`
+}
+
+// ClientTLS — что клиент предложил в ClientHello и о чём договорился с прокси.
+type ClientTLS struct {
+	SNI             string   `msgpack:"sni"`
+	Version         string   `msgpack:"version"`
+	CipherSuite     string   `msgpack:"cipher_suite"`
+	ALPN            string   `msgpack:"alpn"`
+	OfferedVersions []string `msgpack:"offered_versions"`
+	OfferedCiphers  []string `msgpack:"offered_ciphers"`
+	OfferedALPN     []string `msgpack:"offered_alpn"`
+	JA3             string   `msgpack:"ja3"`
+	JA3Hash         string   `msgpack:"ja3_hash"`
+	JA4             string   `msgpack:"ja4"`
+}
+
+// UpstreamTLS — соединение прокси с сервером.
+type UpstreamTLS struct {
+	ServerName  string     `msgpack:"server_name"`
+	Version     string     `msgpack:"version"`
+	CipherSuite string     `msgpack:"cipher_suite"`
+	ALPN        string     `msgpack:"alpn"`
+	Resumed     bool       `msgpack:"resumed"`
+	OCSPStaple  string     `msgpack:"ocsp_staple,omitempty"` // base64 DER
+	Chain       []CertInfo `msgpack:"chain"`
+}
+
+// CertInfo — сертификат из цепочки сервера.
+type CertInfo struct {
+	Subject   string   `msgpack:"subject"`
+	Issuer    string   `msgpack:"issuer"`
+	Serial    string   `msgpack:"serial"`
+	NotBefore int64    `msgpack:"not_before"`
+	NotAfter  int64    `msgpack:"not_after"`
+	DNSNames  []string `msgpack:"dns_names"`
+	SHA256    string   `msgpack:"sha256"`
+}
+
+// RewriteRule — правило Match & Replace для запросов или ответов.
+type RewriteRule struct {
+	ID      string `msgpack:"id" json:"id"`
+	Name    string `msgpack:"name" json:"name"`
+	Enabled bool   `msgpack:"enabled" json:"enabled"`
+	Phase   string `msgpack:"phase" json:"phase"` // request или response
+	Host    string `msgpack:"host" json:"host"`   // glob, пусто — любой хост
+	// Type: header_set, header_remove, header_replace, body_replace, body_regex, cookie_set
+	Type    string `msgpack:"type" json:"type"`
+	Key     string `msgpack:"key" json:"key"` // имя заголовка или cookie
+	Match   string `msgpack:"match" json:"match"`
+	Replace string `msgpack:"replace" json:"replace"`
+}
+
+// WSMessage — сообщение WebSocket из соединения, открытого запросом RequestID.
+type WSMessage struct {
+	RequestID uint64 `msgpack:"request_id" json:"request_id"`
+	Direction string `msgpack:"direction" json:"direction"` // client или server — кто отправил
+	Opcode    int    `msgpack:"opcode" json:"opcode"`
+	Payload   string `msgpack:"payload" json:"payload"`
+	Encoding  string `msgpack:"encoding,omitempty" json:"encoding,omitempty"` // base64 — для двоичных данных
+	Injected  bool   `msgpack:"injected,omitempty" json:"injected,omitempty"` // отправлено через API, а не клиентом или сервером
+	TS        int64  `msgpack:"ts" json:"ts"`                                 // unix, мс
+	// Size — полная длина сообщения; Truncated — в Payload только его начало.
+	Size      int64 `msgpack:"size,omitempty" json:"size,omitempty"`
+	Truncated bool  `msgpack:"truncated,omitempty" json:"truncated,omitempty"`
+}
+
+const (
+	WSFromClient = "client"
+	WSFromServer = "server"
+)
+
+// SSEEvent — событие Server-Sent Events из ответа на запрос RequestID.
+type SSEEvent struct {
+	RequestID uint64 `msgpack:"request_id" json:"request_id"`
+	ID        string `msgpack:"id,omitempty" json:"id,omitempty"`
+	Event     string `msgpack:"event,omitempty" json:"event,omitempty"` // пусто — message
+	Data      string `msgpack:"data" json:"data"`
+	Retry     int    `msgpack:"retry,omitempty" json:"retry,omitempty"` // мс
+	TS        int64  `msgpack:"ts" json:"ts"`                           // unix, мс — когда событие прошло через прокси
 }
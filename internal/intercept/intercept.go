@@ -0,0 +1,545 @@
+package intercept
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/goriiin/go-proxy/internal/domain"
+)
+
+const (
+	PhaseRequest  = "request"
+	PhaseResponse = "response"
+	PhaseBoth     = "both"
+
+	ActionForward = "forward"
+	ActionDrop    = "drop"
+
+	// BodyBase64 — значение body_encoding у тела, переданного в base64.
+	BodyBase64 = "base64"
+)
+
+// ErrDropped — запрос или ответ отброшен из очереди перехвата.
+var ErrDropped = errors.New("intercept: dropped")
+
+// Rule — точка останова: совпавшие запросы (и/или ответы на них) ждут
+// решения в очереди. Пустые поля совпадают с чем угодно.
+type Rule struct {
+	ID     string `json:"id"`
+	Host   string `json:"host"`   // glob, например *.example.com
+	Path   string `json:"path"`   // регулярное выражение по пути
+	Method string `json:"method"` // GET, POST, …
+	Phase  string `json:"phase"`  // request, response или both
+	Enable bool   `json:"enabled"`
+
+	pathRe *regexp.Regexp
+}
+
+// Item — перехваченный запрос или ответ, ожидающий решения. Текстовое
+// тело входит в Raw; двоичное (не UTF-8, в том числе сжатое) в Raw не
+// попадает и отдаётся в Body в base64 с BodyEncoding = "base64".
+type Item struct {
+	ID           string    `json:"id"`
+	Phase        string    `json:"phase"`
+	RuleID       string    `json:"rule_id"`
+	Method       string    `json:"method"`
+	URL          string    `json:"url"`
+	Raw          string    `json:"raw"`
+	Body         string    `json:"body,omitempty"`
+	BodyEncoding string    `json:"body_encoding,omitempty"`
+	Created      time.Time `json:"created"`
+	Deadline     time.Time `json:"deadline"`
+
+	body     []byte
+	decision chan Decision
+}
+
+// Decision — что сделать с элементом очереди: forward (с правкой Raw или без) или drop.
+// Тело с BodyEncoding = "base64" заменяет тело из Raw; у двоичного элемента
+// без Body остаётся исходное тело.
+type Decision struct {
+	Action       string `json:"action"`
+	Raw          string `json:"raw,omitempty"`
+	Body         string `json:"body,omitempty"`
+	BodyEncoding string `json:"body_encoding,omitempty"`
+}
+
+// clientWatchKey — ключ контекста для функции из WithClientWatch.
+type clientWatchKey struct{}
+
+// WithClientWatch возвращает контекст, с которым wait, прежде чем ждать
+// решения, вызывает watch: та следит за соединением клиента и отменяет
+// контекст, если клиент отключился, пока не будет вызвана возвращённая ею
+// функция остановки. Нужен там, где контекст запроса сам не отменяется
+// (запросы, прочитанные через http.ReadRequest).
+func WithClientWatch(ctx context.Context, watch func() (stop func())) context.Context {
+	return context.WithValue(ctx, clientWatchKey{}, watch)
+}
+
+// Interceptor хранит правила и очередь ожидающих элементов.
+// Нулевой *Interceptor ничего не перехватывает.
+type Interceptor struct {
+	timeout       time.Duration
+	timeoutAction string
+
+	mu      sync.Mutex
+	rules   []*Rule
+	pending map[string]*Item
+}
+
+// New создаёт перехватчик. По истечении timeout элемент автоматически
+// получает timeoutAction (forward или drop), чтобы клиент не висел вечно.
+func New(timeout time.Duration, timeoutAction string) *Interceptor {
+	if timeout <= 0 {
+		timeout = 5 * time.Minute
+	}
+	if timeoutAction != ActionDrop {
+		timeoutAction = ActionForward
+	}
+
+	return &Interceptor{
+		timeout:       timeout,
+		timeoutAction: timeoutAction,
+		pending:       make(map[string]*Item),
+	}
+}
+
+// AddRule проверяет и добавляет правило, возвращая его с присвоенным ID.
+func (ic *Interceptor) AddRule(r Rule) (Rule, error) {
+	if r.Phase == "" {
+		r.Phase = PhaseRequest
+	}
+	switch r.Phase {
+	case PhaseRequest, PhaseResponse, PhaseBoth:
+	default:
+		return Rule{}, fmt.Errorf("unknown phase %q", r.Phase)
+	}
+	if _, err := path.Match(r.Host, ""); err != nil {
+		return Rule{}, fmt.Errorf("bad host pattern %q: %w", r.Host, err)
+	}
+	if r.Path != "" {
+		re, err := regexp.Compile(r.Path)
+		if err != nil {
+			return Rule{}, fmt.Errorf("bad path regexp %q: %w", r.Path, err)
+		}
+		r.pathRe = re
+	}
+	r.ID = uuid.NewString()
+
+	ic.mu.Lock()
+	defer ic.mu.Unlock()
+	ic.rules = append(ic.rules, &r)
+
+	return r, nil
+}
+
+// DeleteRule удаляет правило по ID.
+func (ic *Interceptor) DeleteRule(id string) bool {
+	ic.mu.Lock()
+	defer ic.mu.Unlock()
+
+	for i, r := range ic.rules {
+		if r.ID == id {
+			ic.rules = append(ic.rules[:i], ic.rules[i+1:]...)
+			return true
+		}
+	}
+
+	return false
+}
+
+// Rules возвращает копию списка правил.
+func (ic *Interceptor) Rules() []Rule {
+	ic.mu.Lock()
+	defer ic.mu.Unlock()
+
+	out := make([]Rule, 0, len(ic.rules))
+	for _, r := range ic.rules {
+		out = append(out, *r)
+	}
+
+	return out
+}
+
+// Pending возвращает ожидающие решения элементы в порядке поступления.
+func (ic *Interceptor) Pending() []Item {
+	ic.mu.Lock()
+	defer ic.mu.Unlock()
+
+	out := make([]Item, 0, len(ic.pending))
+	for _, it := range ic.pending {
+		out = append(out, *it)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Created.Before(out[j].Created) })
+
+	return out
+}
+
+// Get возвращает ожидающий элемент по ID.
+func (ic *Interceptor) Get(id string) (Item, bool) {
+	ic.mu.Lock()
+	defer ic.mu.Unlock()
+
+	it, ok := ic.pending[id]
+	if !ok {
+		return Item{}, false
+	}
+
+	return *it, true
+}
+
+// Resolve передаёт решение ожидающему элементу.
+func (ic *Interceptor) Resolve(id string, d Decision) error {
+	if d.Action != ActionForward && d.Action != ActionDrop {
+		return fmt.Errorf("unknown action %q", d.Action)
+	}
+	if _, err := d.body(); err != nil {
+		return err
+	}
+
+	ic.mu.Lock()
+	it, ok := ic.pending[id]
+	if ok {
+		delete(ic.pending, id)
+	}
+	ic.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("intercepted item %s not found", id)
+	}
+
+	it.decision <- d
+	return nil
+}
+
+// Request останавливает запрос, если он совпал с правилом, и ждёт решения.
+// Возвращает исходный или отредактированный запрос либо ErrDropped.
+func (ic *Interceptor) Request(req *http.Request) (*http.Request, error) {
+	rule := ic.match(req, PhaseRequest)
+	if rule == nil {
+		return req, nil
+	}
+
+	raw, err := dumpRequest(req)
+	if err != nil {
+		return req, err
+	}
+
+	it := newItem(rule, PhaseRequest, req, raw)
+	d := ic.wait(it, req)
+	switch {
+	case d.Action == ActionDrop:
+		return nil, ErrDropped
+	case it.unchanged(d):
+		return req, nil
+	}
+
+	head, body, err := it.message(d)
+	if err != nil {
+		log.Printf("Cannot decode edited request body, forwarding original: %v", err)
+		return req, nil
+	}
+	edited, err := parseRequest(head, body, req)
+	if err != nil {
+		log.Printf("Cannot parse edited request, forwarding original: %v", err)
+		return req, nil
+	}
+
+	return edited, nil
+}
+
+// Response останавливает ответ на запрос, совпавший с правилом, и ждёт решения.
+func (ic *Interceptor) Response(req *http.Request, resp *http.Response) (*http.Response, error) {
+	rule := ic.match(req, PhaseResponse)
+	if rule == nil {
+		return resp, nil
+	}
+
+	raw, err := dumpResponse(resp)
+	if err != nil {
+		return resp, err
+	}
+
+	it := newItem(rule, PhaseResponse, req, raw)
+	d := ic.wait(it, req)
+	switch {
+	case d.Action == ActionDrop:
+		return nil, ErrDropped
+	case it.unchanged(d):
+		return resp, nil
+	}
+
+	head, body, err := it.message(d)
+	if err != nil {
+		log.Printf("Cannot decode edited response body, forwarding original: %v", err)
+		return resp, nil
+	}
+	edited, err := parseResponse(head, body, req)
+	if err != nil {
+		log.Printf("Cannot parse edited response, forwarding original: %v", err)
+		return resp, nil
+	}
+	_ = resp.Body.Close()
+
+	return edited, nil
+}
+
+func (ic *Interceptor) match(req *http.Request, phase string) *Rule {
+	if ic == nil {
+		return nil
+	}
+
+	ic.mu.Lock()
+	defer ic.mu.Unlock()
+
+	host := req.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	for _, r := range ic.rules {
+		if !r.Enable || (r.Phase != phase && r.Phase != PhaseBoth) {
+			continue
+		}
+		if r.Method != "" && !strings.EqualFold(r.Method, req.Method) {
+			continue
+		}
+		if r.Host != "" {
+			if ok, _ := path.Match(strings.ToLower(r.Host), strings.ToLower(host)); !ok {
+				continue
+			}
+		}
+		if r.pathRe != nil && !r.pathRe.MatchString(req.URL.Path) {
+			continue
+		}
+
+		return r
+	}
+
+	return nil
+}
+
+// newItem готовит элемент очереди из дампа сообщения: текстовое тело
+// остаётся в Raw, двоичное уходит в Body в base64.
+func newItem(rule *Rule, phase string, req *http.Request, raw []byte) *Item {
+	now := time.Now()
+	it := &Item{
+		ID:       uuid.NewString(),
+		Phase:    phase,
+		RuleID:   rule.ID,
+		Method:   req.Method,
+		URL:      req.URL.String(),
+		Raw:      string(raw),
+		Created:  now,
+		decision: make(chan Decision, 1),
+	}
+
+	if i := bytes.Index(raw, []byte("\r\n\r\n")); i >= 0 {
+		head, body := raw[:i+4], raw[i+4:]
+		if len(body) > 0 && domain.IsBinary(body, false) {
+			it.Raw = string(head)
+			it.Body = base64.StdEncoding.EncodeToString(body)
+			it.BodyEncoding = BodyBase64
+			it.body = body
+		}
+	}
+
+	return it
+}
+
+// unchanged сообщает, что решение пропускает элемент без правок.
+func (it *Item) unchanged(d Decision) bool {
+	return (d.Raw == "" || d.Raw == it.Raw) && d.BodyEncoding == ""
+}
+
+// message собирает из решения заголовки и тело: тело из Body (base64),
+// если оно передано, у двоичного элемента — исходное, иначе — из Raw.
+func (it *Item) message(d Decision) (string, []byte, error) {
+	raw := d.Raw
+	if raw == "" {
+		raw = it.Raw
+	}
+	head, body := splitRaw(raw)
+
+	switch {
+	case d.BodyEncoding != "":
+		b, err := d.body()
+		if err != nil {
+			return "", nil, err
+		}
+		body = b
+	case it.BodyEncoding == BodyBase64:
+		body = it.body
+	}
+
+	return head, body, nil
+}
+
+// body декодирует тело, переданное в решении отдельно от Raw.
+func (d Decision) body() ([]byte, error) {
+	switch d.BodyEncoding {
+	case "":
+		return nil, nil
+	case BodyBase64:
+		body, err := base64.StdEncoding.DecodeString(d.Body)
+		if err != nil {
+			return nil, fmt.Errorf("bad base64 body: %w", err)
+		}
+		return body, nil
+	}
+
+	return nil, fmt.Errorf("unknown body_encoding %q", d.BodyEncoding)
+}
+
+func (ic *Interceptor) wait(it *Item, req *http.Request) Decision {
+	it.Deadline = it.Created.Add(ic.timeout)
+	phase := it.Phase
+
+	ic.mu.Lock()
+	ic.pending[it.ID] = it
+	ic.mu.Unlock()
+	log.Printf("Intercepted %s %s %s, waiting as %s", phase, req.Method, it.URL, it.ID)
+
+	timer := time.NewTimer(ic.timeout)
+	defer timer.Stop()
+
+	ctx := req.Context()
+	if watch, ok := ctx.Value(clientWatchKey{}).(func() func()); ok {
+		stop := watch()
+		defer stop()
+	}
+
+	gone := false
+	select {
+	case d := <-it.decision:
+		log.Printf("Intercepted %s %s resolved: %s", phase, it.ID, d.Action)
+		return d
+	case <-ctx.Done():
+		gone = true
+	case <-timer.C:
+	}
+
+	// решение могло прийти одновременно с таймаутом — оно важнее
+	ic.mu.Lock()
+	_, stillPending := ic.pending[it.ID]
+	delete(ic.pending, it.ID)
+	ic.mu.Unlock()
+	if !stillPending {
+		return <-it.decision
+	}
+
+	if gone {
+		// отвечать уже некому
+		log.Printf("Client of intercepted %s %s went away, dropping", phase, it.ID)
+		return Decision{Action: ActionDrop}
+	}
+
+	log.Printf("Intercepted %s %s timed out, applying %s", phase, it.ID, ic.timeoutAction)
+	return Decision{Action: ic.timeoutAction}
+}
+
+// dumpRequest представляет запрос в виде текста HTTP/1.1 с телом
+// фиксированной длины, удобного для правки человеком.
+func dumpRequest(req *http.Request) ([]byte, error) {
+	body, err := readBody(&req.Body)
+	if err != nil {
+		return nil, err
+	}
+	req.ContentLength = int64(len(body))
+	req.TransferEncoding = nil
+
+	return httputil.DumpRequest(req, true)
+}
+
+func dumpResponse(resp *http.Response) ([]byte, error) {
+	body, err := readBody(&resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	resp.ContentLength = int64(len(body))
+	resp.TransferEncoding = nil
+
+	return httputil.DumpResponse(resp, true)
+}
+
+func readBody(body *io.ReadCloser) ([]byte, error) {
+	if *body == nil || *body == http.NoBody {
+		return nil, nil
+	}
+	raw, err := io.ReadAll(*body)
+	_ = (*body).Close()
+	*body = io.NopCloser(bytes.NewReader(raw))
+
+	return raw, err
+}
+
+// splitRaw отделяет заголовки от тела. Content-Length и Transfer-Encoding
+// выбрасываются: withLength потом ставит длину фактического тела, чтобы
+// правка не ломала разбор.
+func splitRaw(raw string) (string, []byte) {
+	raw = strings.ReplaceAll(raw, "\r\n", "\n")
+	head, body, _ := strings.Cut(raw, "\n\n")
+
+	var b strings.Builder
+	for _, line := range strings.Split(head, "\n") {
+		name, _, _ := strings.Cut(line, ":")
+		if strings.EqualFold(strings.TrimSpace(name), "Content-Length") ||
+			strings.EqualFold(strings.TrimSpace(name), "Transfer-Encoding") {
+			continue
+		}
+		b.WriteString(line + "\r\n")
+	}
+
+	return b.String(), []byte(body)
+}
+
+// withLength завершает заголовки из splitRaw длиной тела.
+func withLength(head string, body []byte) string {
+	return head + "Content-Length: " + strconv.Itoa(len(body)) + "\r\n\r\n"
+}
+
+func parseRequest(head string, body []byte, orig *http.Request) (*http.Request, error) {
+	req, err := http.ReadRequest(bufio.NewReader(strings.NewReader(withLength(head, body))))
+	if err != nil {
+		return nil, err
+	}
+
+	if req.URL.Host == "" {
+		req.URL.Host = orig.URL.Host
+	}
+	if req.URL.Scheme == "" {
+		req.URL.Scheme = orig.URL.Scheme
+	}
+	req.RequestURI = ""
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	req.ContentLength = int64(len(body))
+
+	return req.WithContext(orig.Context()), nil
+}
+
+func parseResponse(head string, body []byte, req *http.Request) (*http.Response, error) {
+	resp, err := http.ReadResponse(bufio.NewReader(strings.NewReader(withLength(head, body))), req)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	resp.ContentLength = int64(len(body))
+
+	return resp, nil
+}
@@ -0,0 +1,144 @@
+package proxy
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+)
+
+const authRealm = "go-proxy"
+
+// Auth — проверка клиентов прокси: список разрешённых адресов и
+// логины/пароли для Basic-аутентификации.
+type Auth struct {
+	users map[string]string
+	allow []*net.IPNet
+}
+
+// LoadAuth читает файл учётных записей и список разрешённых адресов.
+// Файл состоит из строк "user:password" или "user:{SHA}base64" (htpasswd -s);
+// пустые строки и строки с # пропускаются. Пустой путь — без паролей.
+func LoadAuth(credentialsFile string, allow []string) (*Auth, error) {
+	a := &Auth{}
+
+	for _, s := range allow {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+		if !strings.Contains(s, "/") {
+			if ip := net.ParseIP(s); ip != nil && ip.To4() != nil {
+				s += "/32"
+			} else {
+				s += "/128"
+			}
+		}
+		_, ipNet, err := net.ParseCIDR(s)
+		if err != nil {
+			return nil, fmt.Errorf("bad allowed address %q: %w", s, err)
+		}
+		a.allow = append(a.allow, ipNet)
+	}
+
+	if credentialsFile == "" {
+		return a, nil
+	}
+
+	fd, err := os.Open(credentialsFile)
+	if err != nil {
+		return nil, err
+	}
+	defer fd.Close()
+
+	a.users = map[string]string{}
+	sc := bufio.NewScanner(fd)
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		user, pass, ok := strings.Cut(line, ":")
+		if !ok || user == "" {
+			return nil, fmt.Errorf("%s:%d: expected user:password", credentialsFile, n)
+		}
+		a.users[user] = pass
+	}
+	if err = sc.Err(); err != nil {
+		return nil, err
+	}
+
+	return a, nil
+}
+
+// RequiresPassword сообщает, нужно ли клиентам присылать логин и пароль.
+func (a *Auth) RequiresPassword() bool {
+	return a != nil && a.users != nil
+}
+
+// AllowedAddr проверяет адрес клиента по списку разрешённых сетей.
+func (a *Auth) AllowedAddr(addr net.Addr) bool {
+	if a == nil || len(a.allow) == 0 {
+		return true
+	}
+
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		host = addr.String()
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	for _, n := range a.allow {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Check проверяет пару логин/пароль.
+func (a *Auth) Check(user, pass string) bool {
+	want, ok := a.users[user]
+	if !ok {
+		return false
+	}
+
+	if hash, isSHA := strings.CutPrefix(want, "{SHA}"); isSHA {
+		sum := sha1.Sum([]byte(pass))
+		pass = base64.StdEncoding.EncodeToString(sum[:])
+		want = hash
+	}
+
+	return subtle.ConstantTimeCompare([]byte(want), []byte(pass)) == 1
+}
+
+// authenticate разбирает заголовок Proxy-Authorization запроса и
+// возвращает имя пользователя. Без настроенных паролей пропускает всех.
+func (a *Auth) authenticate(req *http.Request) (string, bool) {
+	if !a.RequiresPassword() {
+		return "", true
+	}
+
+	scheme, creds, ok := strings.Cut(req.Header.Get("Proxy-Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Basic") {
+		return "", false
+	}
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(creds))
+	if err != nil {
+		return "", false
+	}
+	user, pass, ok := strings.Cut(string(raw), ":")
+	if !ok || !a.Check(user, pass) {
+		return "", false
+	}
+
+	return user, true
+}
@@ -0,0 +1,87 @@
+package proxy
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"io"
+	"net/http"
+	"sync"
+)
+
+// bodyCapture пропускает тело через себя без задержки, запоминая первые
+// limit байт, полную длину, SHA-256 и то, дочитано ли тело до конца.
+// onClose вызывается один раз при закрытии — к этому моменту тело уже
+// отдано получателю или получатель ушёл, не дочитав.
+type bodyCapture struct {
+	rc    io.ReadCloser
+	limit int
+	buf   bytes.Buffer
+	size  int64
+	sum   hash.Hash
+	eof   bool
+
+	mu      sync.Mutex
+	once    sync.Once
+	onClose func()
+}
+
+// newBodyCapture оборачивает тело; nil и http.NoBody дают пустой снимок.
+func newBodyCapture(rc io.ReadCloser, limit int) *bodyCapture {
+	if rc == http.NoBody {
+		rc = nil
+	}
+
+	return &bodyCapture{rc: rc, limit: limit, sum: sha256.New()}
+}
+
+func (c *bodyCapture) Read(b []byte) (int, error) {
+	if c.rc == nil {
+		return 0, io.EOF
+	}
+
+	n, err := c.rc.Read(b)
+	if n > 0 || err == io.EOF {
+		c.mu.Lock()
+		c.size += int64(n)
+		c.sum.Write(b[:n])
+		if room := c.limit - c.buf.Len(); room > 0 {
+			c.buf.Write(b[:min(n, room)])
+		}
+		c.eof = c.eof || err == io.EOF
+		c.mu.Unlock()
+	}
+
+	return n, err
+}
+
+func (c *bodyCapture) Close() error {
+	var err error
+	if c.rc != nil {
+		err = c.rc.Close()
+	}
+	c.once.Do(func() {
+		if c.onClose != nil {
+			c.onClose()
+		}
+	})
+
+	return err
+}
+
+// snapshot — сохранённый префикс, длина и SHA-256 прочитанного, признак
+// обрезки по лимиту и признак того, что тело не дочитано до конца (клиент
+// или сервер оборвал соединение). У nil — пустое тело без хеша (ответ 101).
+func (c *bodyCapture) snapshot() ([]byte, int64, string, bool, bool) {
+	if c == nil {
+		return nil, 0, "", false, false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	incomplete := c.rc != nil && !c.eof
+
+	return c.buf.Bytes(), c.size, hex.EncodeToString(c.sum.Sum(nil)), c.size > int64(c.buf.Len()), incomplete
+}
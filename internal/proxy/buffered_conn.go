@@ -0,0 +1,35 @@
+package proxy
+
+import (
+	"bufio"
+	"io"
+	"net"
+)
+
+// bufferedConn отдаёт сначала данные, уже прочитанные в bufio.Reader,
+// а затем продолжает читать из исходного соединения. Нужен, когда клиент
+// отправил TLS ClientHello сразу вслед за CONNECT.
+type bufferedConn struct {
+	net.Conn
+	r io.Reader
+}
+
+func newBufferedConn(conn net.Conn, r *bufio.Reader) net.Conn {
+	if r.Buffered() == 0 {
+		return conn
+	}
+
+	return &bufferedConn{Conn: conn, r: r}
+}
+
+func (c *bufferedConn) Read(b []byte) (int, error) {
+	return c.r.Read(b)
+}
+
+func (c *bufferedConn) CloseWrite() error {
+	if cw, ok := c.Conn.(interface{ CloseWrite() error }); ok {
+		return cw.CloseWrite()
+	}
+
+	return c.Conn.Close()
+}
@@ -0,0 +1,82 @@
+package proxy
+
+import (
+	"io"
+	"log"
+	"net/http"
+	"sync"
+	"sync/atomic"
+)
+
+// maxDrainBody — сколько недочитанного тела запроса прокси готов
+// пропустить, чтобы оставить соединение открытым для следующего запроса.
+const maxDrainBody = 256 << 10
+
+// clientBody — тело запроса, прочитанного с соединения клиента HTTP/1.x.
+// Запоминает, дочитано ли оно: до этого соединение читает транспорт, и
+// смотреть в него (за отключением клиента или следующим запросом) нельзя.
+// Close тело не дочитывает — это делает drain, с ограничением.
+type clientBody struct {
+	rc  io.ReadCloser
+	mu  sync.Mutex
+	eof atomic.Bool
+}
+
+// newClientBody оборачивает req.Body; у запроса без тела оно сразу дочитано.
+func newClientBody(rc io.ReadCloser) *clientBody {
+	b := &clientBody{rc: rc}
+	if rc == nil || rc == http.NoBody {
+		b.eof.Store(true)
+	}
+
+	return b
+}
+
+func (b *clientBody) Read(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	n, err := b.rc.Read(p)
+	if err == io.EOF {
+		b.eof.Store(true)
+	}
+
+	return n, err
+}
+
+// Close ничего не делает: Close тела из http.ReadRequest дочитал бы его
+// целиком, сколько бы клиент ни прислал.
+func (b *clientBody) Close() error {
+	return nil
+}
+
+// drain дочитывает остаток тела, но не больше limit байт, и сообщает,
+// дошло ли оно до конца. Если нет (ошибка, лимит), граница следующего
+// запроса неизвестна и соединение надо закрыть, иначе остаток тела
+// прочитался бы как новый запрос.
+func (b *clientBody) drain(limit int64) bool {
+	if b.done() {
+		return true
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	n, err := io.CopyN(io.Discard, b.rc, limit+1)
+	if err == io.EOF {
+		b.eof.Store(true)
+		return true
+	}
+	if err != nil {
+		log.Printf("Failed to drain request body after %d bytes: %v", n, err)
+	} else {
+		log.Printf("Unread request body exceeds %d bytes, closing connection", limit)
+	}
+
+	return false
+}
+
+// done сообщает, что тело прочитано до конца.
+func (b *clientBody) done() bool {
+	return b.eof.Load()
+}
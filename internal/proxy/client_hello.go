@@ -0,0 +1,87 @@
+package proxy
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"io"
+	"net"
+	"time"
+)
+
+// peekClientHello читает TLS ClientHello клиента, не нарушая рукопожатия:
+// прочитанные байты возвращаются через conn, который надо использовать дальше.
+func peekClientHello(clientConn net.Conn, reader *bufio.Reader) (*tls.ClientHelloInfo, net.Conn) {
+	var buf bytes.Buffer
+	var hello *tls.ClientHelloInfo
+
+	_ = clientConn.SetReadDeadline(time.Now().Add(sniffTimeout))
+	_ = tls.Server(readOnlyConn{r: io.TeeReader(reader, &buf)}, &tls.Config{
+		GetConfigForClient: func(info *tls.ClientHelloInfo) (*tls.Config, error) {
+			hello = &tls.ClientHelloInfo{}
+			*hello = *info
+			hello.Conn = nil
+			// прерываем рукопожатие: нам нужен был только ClientHello
+			return nil, errHelloCaptured
+		},
+	}).Handshake()
+	_ = clientConn.SetReadDeadline(time.Time{})
+
+	return hello, &bufferedConn{Conn: clientConn, r: io.MultiReader(&buf, reader)}
+}
+
+var errHelloCaptured = errors.New("client hello captured")
+
+// readOnlyConn отдаёт tls.Server байты клиента и глотает всё, что тот пишет в ответ.
+type readOnlyConn struct {
+	net.Conn
+	r io.Reader
+}
+
+func (c readOnlyConn) Read(p []byte) (int, error)         { return c.r.Read(p) }
+func (c readOnlyConn) Write(p []byte) (int, error)        { return len(p), nil }
+func (c readOnlyConn) Close() error                       { return nil }
+func (c readOnlyConn) LocalAddr() net.Addr                { return nil }
+func (c readOnlyConn) RemoteAddr() net.Addr               { return nil }
+func (c readOnlyConn) SetDeadline(t time.Time) error      { return nil }
+func (c readOnlyConn) SetReadDeadline(t time.Time) error  { return nil }
+func (c readOnlyConn) SetWriteDeadline(t time.Time) error { return nil }
+
+// maxHelloSize — сколько байт рукопожатия хранить ради разбора ClientHello.
+const maxHelloSize = 64 << 10
+
+// helloRecorder запоминает байты, прочитанные tls.Server до конца
+// рукопожатия, чтобы потом разобрать из них ClientHello целиком, а при
+// неудаче — найти алерт, которым клиент оборвал рукопожатие.
+type helloRecorder struct {
+	net.Conn
+	buf  bytes.Buffer
+	done bool
+}
+
+func (c *helloRecorder) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	if !c.done && c.buf.Len() < maxHelloSize {
+		c.buf.Write(p[:n])
+	}
+
+	return n, err
+}
+
+// stop прекращает запись и возвращает накопленные байты.
+func (c *helloRecorder) stop() []byte {
+	c.done = true
+	data := c.buf.Bytes()
+	c.buf = bytes.Buffer{}
+
+	return data
+}
+
+func (c *helloRecorder) CloseWrite() error {
+	if cw, ok := c.Conn.(interface{ CloseWrite() error }); ok {
+		return cw.CloseWrite()
+	}
+
+	return c.Conn.Close()
+}
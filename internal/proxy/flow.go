@@ -0,0 +1,66 @@
+package proxy
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/goriiin/go-proxy/internal/domain"
+	"github.com/goriiin/go-proxy/internal/upstream"
+)
+
+// flow — сведения о клиентском соединении, общие для всех его запросов
+// (в том числе пришедших внутри CONNECT- или SOCKS5-туннеля).
+type flow struct {
+	// user — пользователь, прошедший аутентификацию прокси.
+	user string
+	// tls — ClientHello и параметры TLS клиента, если соединение расшифровано.
+	tls *domain.ClientTLS
+	// stream — номер потока HTTP/2; задаётся в копии flow для каждого потока.
+	stream uint32
+	// serverName — имя из SNI клиента, с которым прокси открывает TLS к
+	// серверу; tunnelHost — хост, к которому идёт туннель (в прозрачном
+	// режиме — исходный адрес назначения). Имя используется, только пока
+	// запрос идёт на tunnelHost: запрос, перенаправленный в Intercept, его
+	// не получает.
+	serverName, tunnelHost string
+}
+
+func (f *flow) meta() domain.Meta {
+	m := domain.Meta{User: f.user, StreamID: f.stream}
+	if f.tls != nil {
+		m.TLS = &domain.TLSInfo{Client: f.tls}
+	}
+
+	return m
+}
+
+// upstreamServerName — имя, которым прокси представляется серверу в TLS:
+// SNI клиента, а без него — хост из заголовка Host. Туннель к IP не должен
+// превращаться в TLS без SNI и с проверкой сертификата по IP. Пустая
+// строка — имя берётся из URL.
+func (f *flow) upstreamServerName(req *http.Request) string {
+	if f.tunnelHost == "" || req.URL.Hostname() != f.tunnelHost {
+		return ""
+	}
+	if f.serverName != "" {
+		return f.serverName
+	}
+	host := req.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+
+	return strings.ToLower(strings.TrimSuffix(host, "."))
+}
+
+// upstreamContext добавляет к контексту запроса имя из upstreamServerName.
+func (f *flow) upstreamContext(req *http.Request) context.Context {
+	name := f.upstreamServerName(req)
+	if name == "" {
+		return req.Context()
+	}
+
+	return upstream.WithServerName(req.Context(), name)
+}
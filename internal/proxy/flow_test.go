@@ -0,0 +1,32 @@
+package proxy
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestUpstreamServerName(t *testing.T) {
+	tests := []struct {
+		name string
+		flow flow
+		url  string
+		host string
+		want string
+	}{
+		{"sni", flow{serverName: "example.com", tunnelHost: "10.0.0.1"}, "https://10.0.0.1/", "other.com", "example.com"},
+		{"no sni, host header", flow{tunnelHost: "10.0.0.1"}, "https://10.0.0.1/", "Example.COM:443", "example.com"},
+		{"no sni, no host", flow{tunnelHost: "10.0.0.1"}, "https://10.0.0.1/", "", ""},
+		{"retargeted by intercept", flow{serverName: "example.com", tunnelHost: "10.0.0.1"}, "https://10.0.0.2/", "example.com", ""},
+		{"not a tunnel", flow{}, "http://example.com/", "example.com", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest(http.MethodGet, tt.url, nil)
+			req.Host = tt.host
+			if got := tt.flow.upstreamServerName(req); got != tt.want {
+				t.Errorf("upstreamServerName() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -1,23 +1,31 @@
 package proxy
 
 import (
+	"crypto"
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/tls"
 	"crypto/x509"
 	"crypto/x509/pkix"
-	"encoding/pem"
 	"fmt"
 	"math/big"
 	"net"
+	"slices"
 	"time"
 )
 
-func (p *Proxy) generateCert(host string) (*tls.Certificate, error) {
-	hostPrivKey, err := rsa.GenerateKey(rand.Reader, 2048)
+// generateCert выпускает сертификат для host, подписанный нашим CA.
+// Если известен сертификат настоящего сервера, его DNS-имена и IP
+// добавляются в SAN, чтобы сертификат подходил для тех же имён.
+func (p *Proxy) generateCert(host string, upstream *x509.Certificate) (*tls.Certificate, error) {
+	hostPrivKey, err := p.leafKeys.get()
 	if err != nil {
 		return nil, fmt.Errorf("failed to generate host private key: %w", err)
 	}
+	caKey, ok := p.caCert.PrivateKey.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("CA key %T cannot sign", p.caCert.PrivateKey)
+	}
 
 	serialNumberLimit := new(big.Int).Lsh(big.NewInt(1), 128)
 	serialNumber, err := rand.Int(rand.Reader, serialNumberLimit)
@@ -35,37 +43,104 @@ func (p *Proxy) generateCert(host string) (*tls.Certificate, error) {
 		NotBefore: time.Now().Add(-1 * time.Hour),
 		NotAfter:  time.Now().Add(8760 * time.Hour),
 
-		KeyUsage:    x509.KeyUsageKeyEncipherment | x509.KeyUsageDigitalSignature,
+		KeyUsage:    x509.KeyUsageDigitalSignature,
 		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}, // Required for server TLS
 
 		BasicConstraintsValid: true,
 	}
+	if _, isRSA := hostPrivKey.(*rsa.PrivateKey); isRSA {
+		// RSA-обмен ключами в TLS 1.2 шифрует секрет открытым ключом сервера
+		template.KeyUsage |= x509.KeyUsageKeyEncipherment
+	}
 
 	if ip := net.ParseIP(host); ip != nil {
 		template.IPAddresses = append(template.IPAddresses, ip)
 	} else {
 		template.DNSNames = append(template.DNSNames, host)
 	}
+	if upstream != nil && p.mirrorCert {
+		mirrorUpstream(&template, upstream, host)
+	} else if upstream != nil {
+		for _, name := range upstream.DNSNames {
+			if !slices.Contains(template.DNSNames, name) {
+				template.DNSNames = append(template.DNSNames, name)
+			}
+		}
+		for _, ip := range upstream.IPAddresses {
+			if !slices.ContainsFunc(template.IPAddresses, ip.Equal) {
+				template.IPAddresses = append(template.IPAddresses, ip)
+			}
+		}
+	}
+	clampValidity(&template, p.caCert.Leaf)
 
-	derBytes, err := x509.CreateCertificate(rand.Reader, &template, p.caCert.Leaf, &hostPrivKey.PublicKey, p.caCert.PrivateKey)
+	derBytes, err := x509.CreateCertificate(rand.Reader, &template, p.caCert.Leaf, hostPrivKey.Public(), caKey)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create certificate: %w", err)
 	}
 
-	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: derBytes})
-	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(hostPrivKey)})
-
-	generatedCert, err := tls.X509KeyPair(certPEM, keyPEM)
+	leaf, err := x509.ParseCertificate(derBytes)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create tls key pair: %w", err)
+		return nil, fmt.Errorf("failed to parse generated certificate: %w", err)
 	}
 
-	generatedCert.Leaf, err = x509.ParseCertificate(derBytes)
-	if err != nil {
-		return nil, fmt.Errorf("failed to parse generated certificate: %w", err)
+	return &tls.Certificate{
+		Certificate: append([][]byte{derBytes}, p.caChain...),
+		PrivateKey:  hostPrivKey,
+		Leaf:        leaf,
+	}, nil
+}
+
+// mirrorUpstream копирует в шаблон субъект, SAN и срок действия настоящего
+// сертификата, чтобы поддельный выглядел для клиента так же (срок потом
+// сужается до срока CA, см. clampValidity). Если настоящий
+// сертификат не покрывает host, имя добавляется в SAN.
+func mirrorUpstream(template *x509.Certificate, upstream *x509.Certificate, host string) {
+	template.Subject = pkix.Name{
+		Country:            upstream.Subject.Country,
+		Organization:       upstream.Subject.Organization,
+		OrganizationalUnit: upstream.Subject.OrganizationalUnit,
+		Locality:           upstream.Subject.Locality,
+		Province:           upstream.Subject.Province,
+		StreetAddress:      upstream.Subject.StreetAddress,
+		PostalCode:         upstream.Subject.PostalCode,
+		SerialNumber:       upstream.Subject.SerialNumber,
+		CommonName:         upstream.Subject.CommonName,
 	}
+	template.NotBefore = upstream.NotBefore
+	template.NotAfter = upstream.NotAfter
+	template.DNSNames = slices.Clone(upstream.DNSNames)
+	template.IPAddresses = slices.Clone(upstream.IPAddresses)
+	template.EmailAddresses = slices.Clone(upstream.EmailAddresses)
+	template.URIs = slices.Clone(upstream.URIs)
 
-	p.certCache[host] = &generatedCert
+	if upstream.VerifyHostname(host) == nil {
+		return
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		template.IPAddresses = append(template.IPAddresses, ip)
+	} else {
+		template.DNSNames = append(template.DNSNames, host)
+	}
+}
+
+// clampValidity сужает срок действия листа до срока CA: лист, который
+// выходит за срок своего издателя, клиенты отвергают. Срок, целиком
+// лежащий вне срока CA, сжимается до его границы — лист остаётся
+// недействительным, как и настоящий сертификат, срок которого скопировал
+// mirrorUpstream.
+func clampValidity(template *x509.Certificate, ca *x509.Certificate) {
+	template.NotBefore = clampTime(template.NotBefore, ca.NotBefore, ca.NotAfter)
+	template.NotAfter = clampTime(template.NotAfter, template.NotBefore, ca.NotAfter)
+}
+
+func clampTime(t, from, to time.Time) time.Time {
+	if t.Before(from) {
+		return from
+	}
+	if t.After(to) {
+		return to
+	}
 
-	return &generatedCert, nil
+	return t
 }
@@ -0,0 +1,35 @@
+package proxy
+
+import (
+	"crypto/x509"
+	"testing"
+	"time"
+)
+
+func TestClampValidity(t *testing.T) {
+	day := func(n int) time.Time { return time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC).AddDate(0, 0, n) }
+	ca := &x509.Certificate{NotBefore: day(0), NotAfter: day(100)}
+
+	tests := []struct {
+		name                  string
+		notBefore, notAfter   time.Time
+		wantBefore, wantAfter time.Time
+	}{
+		{"inside", day(10), day(20), day(10), day(20)},
+		{"starts before ca", day(-30), day(20), day(0), day(20)},
+		{"outlives ca", day(10), day(400), day(10), day(100)},
+		{"covers ca", day(-30), day(400), day(0), day(100)},
+		{"expired before ca", day(-60), day(-30), day(0), day(0)},
+		{"starts after ca", day(200), day(300), day(100), day(100)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			template := &x509.Certificate{NotBefore: tt.notBefore, NotAfter: tt.notAfter}
+			clampValidity(template, ca)
+			if !template.NotBefore.Equal(tt.wantBefore) || !template.NotAfter.Equal(tt.wantAfter) {
+				t.Errorf("validity = %v – %v, want %v – %v", template.NotBefore, template.NotAfter, tt.wantBefore, tt.wantAfter)
+			}
+		})
+	}
+}
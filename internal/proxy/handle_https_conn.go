@@ -1,131 +1,227 @@
 package proxy
 
 import (
+	"bufio"
 	"crypto/tls"
+	"errors"
 	"fmt"
-	"io"
 	"log"
 	"net"
+	"net/http"
 	"strings"
-	"sync"
-	"time"
+
+	"github.com/goriiin/go-proxy/internal/tlsmeta"
 )
 
-func (p *Proxy) handleHTTPSConnect(clientConn net.Conn, targetHost string) {
-	host, port, err := net.SplitHostPort(targetHost)
-	originalTargetHost := targetHost
+func (p *Proxy) handleHTTPSConnect(clientConn net.Conn, targetHost string, f *flow) {
+	targetHost, host := splitTarget(targetHost, "443")
+	log.Printf("Handling CONNECT for %s", targetHost)
+
+	_, err := fmt.Fprintf(clientConn, "HTTP/1.0 200 Connection established\r\nProxy-agent: GoProxy/1.0\r\n\r\n")
 	if err != nil {
-		host = targetHost
-		port = "443"
-		targetHost = net.JoinHostPort(host, port)
-		log.Printf("Port missing in CONNECT target '%s', assuming 443: %s", originalTargetHost, targetHost)
+		log.Printf("Failed to send '200 Connection established' to client: %v", err)
+		return
 	}
+	log.Printf("Sent '200 Connection established' to client for %s", targetHost)
 
-	log.Printf("Handling CONNECT for %s", targetHost)
+	if reason := p.skipTLS(host, targetHost); reason != "" {
+		log.Printf("%s is %s, tunnelling without interception", targetHost, reason)
+		p.relayRaw(clientConn, targetHost)
+		return
+	}
 
-	generatedCert, err := p.GetCertificate(host)
-	if err != nil {
-		generatedCert, err = p.generateCert(host)
-		if err != nil {
-			log.Printf("Failed to generate certificate for %s: %v", host, err)
-			fmt.Fprintf(clientConn, "HTTP/1.1 502 Bad Gateway\r\nConnection: close\r\n\r\n")
+	// SNI может назвать другой хост, чем CONNECT: passthrough и scope
+	// проверяются и для него, иначе CONNECT на IP расшифровал бы что угодно
+	hello, conn := peekClientHello(clientConn, bufio.NewReader(clientConn))
+	if hello != nil {
+		if reason := p.skipTLSFor(host, targetHost, hello.ServerName); reason != "" {
+			log.Printf("SNI %q via %s is %s, tunnelling without interception", hello.ServerName, targetHost, reason)
+			p.relayRaw(conn, targetHost)
 			return
 		}
 	}
 
-	_, err = fmt.Fprintf(clientConn, "HTTP/1.0 200 Connection established\r\nProxy-agent: GoProxy/1.0\r\n\r\n")
+	p.interceptTLS(conn, targetHost, host, f)
+}
+
+// splitTarget дополняет адрес портом по умолчанию и возвращает его вместе с именем хоста.
+func splitTarget(targetHost, defaultPort string) (string, string) {
+	host, _, err := net.SplitHostPort(targetHost)
 	if err != nil {
-		log.Printf("Failed to send '200 Connection established' to client: %v", err)
-		return
+		host = targetHost
+		log.Printf("Port missing in target '%s', assuming %s", targetHost, defaultPort)
+		targetHost = net.JoinHostPort(host, defaultPort)
 	}
-	log.Printf("Sent '200 Connection established' to client for %s", targetHost)
 
+	return targetHost, host
+}
+
+// skipTLS возвращает причину, по которой TLS с targetHost не расшифровывается,
+// или пустую строку.
+func (p *Proxy) skipTLS(host, targetHost string) string {
+	switch {
+	case p.passthrough.Match(host):
+		return "in the TLS passthrough list"
+	case p.scope.Tunnel("https", targetHost):
+		return "out of scope"
+	}
+
+	return ""
+}
+
+// skipTLSFor — skipTLS с учётом SNI из ClientHello: passthrough проверяется
+// и для адреса назначения, и для имени из SNI, scope — по имени из SNI,
+// если клиент его прислал. Соединяться прокси всё равно будет с targetHost.
+func (p *Proxy) skipTLSFor(host, targetHost, serverName string) string {
+	name := sniName(serverName, host)
+	if name == host {
+		return p.skipTLS(host, targetHost)
+	}
+	if p.passthrough.Match(host) {
+		return "in the TLS passthrough list"
+	}
+
+	port := "443"
+	if _, dstPort, err := net.SplitHostPort(targetHost); err == nil {
+		port = dstPort
+	}
+
+	return p.skipTLS(name, net.JoinHostPort(name, port))
+}
+
+// certificateFor берёт сертификат для host из кеша или выпускает новый,
+// повторяя SAN настоящего сертификата сервера targetHost, если его удалось получить.
+// Параллельные соединения к одному хосту дожидаются одного выпуска.
+// Ключ кеша включает certProfile, поэтому сертификаты, выпущенные другим
+// CA или с другими параметрами, из хранилища не возвращаются.
+func (p *Proxy) certificateFor(host, targetHost string) (*tls.Certificate, error) {
+	return p.certCache.GetOrCreate(host+"@"+p.certProfile, func() (*tls.Certificate, error) {
+		upstreamCert, err := p.upstreamCertificate(targetHost, host)
+		if err != nil {
+			log.Printf("Cannot fetch upstream certificate of %s: %v", targetHost, err)
+		}
+
+		return p.generateCert(host, upstreamCert)
+	})
+}
+
+// interceptTLS завершает TLS клиента поддельным сертификатом и пропускает
+// расшифрованные запросы через общий конвейер прокси. Сертификат выбирается
+// по SNI из ClientHello, а без него — по хосту из CONNECT; сервер назначения
+// — всегда targetHost, SNI на него не влияет.
+func (p *Proxy) interceptTLS(clientConn net.Conn, targetHost, host string, f *flow) {
 	tlsClientConfig := &tls.Config{
-		Certificates: []tls.Certificate{*generatedCert},
-		MinVersion:   tls.VersionTLS12,
+		GetCertificate: func(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+			// сертификат сервера берём по исходному адресу, но с SNI клиента
+			name := sniName(hello.ServerName, host)
+			cert, err := p.certificateFor(name, targetHost)
+			if err != nil {
+				log.Printf("Failed to generate certificate for %s: %v", name, err)
+			}
+
+			return cert, err
+		},
+		MinVersion: tls.VersionTLS12,
+		NextProtos: []string{"http/1.1"},
+	}
+	if p.http2 {
+		tlsClientConfig.NextProtos = []string{"h2", "http/1.1"}
 	}
 
-	tlsClientConn := tls.Server(clientConn, tlsClientConfig)
-	err = tlsClientConn.Handshake()
+	rec := &helloRecorder{Conn: clientConn}
+	tlsClientConn := tls.Server(rec, tlsClientConfig)
+	err := tlsClientConn.Handshake()
 	if err != nil {
 		log.Printf("TLS handshake with client failed for %s: %v", host, err)
+		p.passthrough.handshakeFailed(host, rejectedCertificate(err, rec.stop()))
 
 		return
 	}
+	p.passthrough.handshakeSucceeded(host)
+
+	hello, err := tlsmeta.ParseClientHello(rec.stop())
+	if err != nil {
+		log.Printf("Cannot parse ClientHello from %s: %v", clientConn.RemoteAddr(), err)
+	}
+	f.tls = tlsmeta.Client(hello, tlsClientConn.ConnectionState())
+	// соединяемся с targetHost, но представляемся серверу именем из SNI
+	f.serverName = sniName(tlsClientConn.ConnectionState().ServerName, "")
+	f.tunnelHost = host
 	defer func(tlsClientConn *tls.Conn) {
 		err = tlsClientConn.Close()
-		if err != nil {
+		if err != nil && !errors.Is(err, net.ErrClosed) {
 			log.Printf("Failed to close TLS connection: %v", err)
 		}
 	}(tlsClientConn)
 	log.Printf("TLS handshake with client successful for %s", host)
 
-	targetServerConn, err := net.DialTimeout("tcp", targetHost, 15*time.Second)
-	if err != nil {
-		log.Printf("Failed to connect to target server %s: %v", targetHost, err)
-
-		return
+	if tlsClientConn.ConnectionState().NegotiatedProtocol == "h2" {
+		p.serveHTTP2(tlsClientConn, targetHost, host, f)
+	} else {
+		p.relayRequests(tlsClientConn, "https", targetHost, host, f)
 	}
-	defer func(targetServerConn net.Conn) {
-		err = targetServerConn.Close()
-		if err != nil {
-			log.Printf("Failed to close target server: %v", err)
-		}
-	}(targetServerConn)
-	log.Printf("Established TCP connection to target server %s", targetHost)
+	log.Printf("Data relay finished for %s", targetHost)
+}
 
-	tlsServerConfig := &tls.Config{
-		ServerName: host,
-		MinVersion: tls.VersionTLS12,
+// sniName — имя для сертификата: из SNI или, если клиент его не прислал, host.
+func sniName(serverName, host string) string {
+	serverName = strings.ToLower(strings.TrimSuffix(serverName, "."))
+	if serverName == "" {
+		return host
 	}
-	tlsServerConn := tls.Client(targetServerConn, tlsServerConfig)
-	err = tlsServerConn.Handshake()
-	if err != nil {
-		log.Printf("TLS handshake with target server %s failed: %v", targetHost, err)
-		return
-	}
-	defer func(tlsServerConn *tls.Conn) {
-		err = tlsServerConn.Close()
-		if err != nil {
-			log.Printf("Failed to close TLS connection for %s: %v", host, err)
-		}
-	}(tlsServerConn)
-	log.Printf("TLS handshake with target server %s successful", targetHost)
 
-	var wg sync.WaitGroup
-	wg.Add(2)
+	return serverName
+}
 
-	go func() {
-		defer wg.Done()
-		bytesCopied, err := io.Copy(tlsServerConn, tlsClientConn)
-		if err != nil && err != io.EOF && !strings.Contains(err.Error(), "use of closed network connection") {
-			log.Printf("Error copying client to server (%s): %v (%d bytes)", targetHost, err, bytesCopied)
-		}
+// relayRequests обслуживает запросы клиента, пришедшие внутри туннеля
+// (CONNECT, SOCKS5, прозрачный режим), в цикле keep-alive и сохраняет
+// каждую пару запрос/ответ с указанной схемой. Если targetHost пуст,
+// сервер назначения берётся из заголовка Host каждого запроса.
+func (p *Proxy) relayRequests(clientConn net.Conn, scheme, targetHost, host string, f *flow) {
+	clientReader := bufio.NewReader(clientConn)
 
-		if err = tlsServerConn.CloseWrite(); err != nil {
-			if !strings.Contains(err.Error(), "use of closed network connection") {
-				log.Printf("Error calling CloseWrite on server connection (%s): %v", targetHost, err)
-			}
+	for {
+		req, err := p.readRequest(clientConn, clientReader)
+		if err != nil {
+			return
 		}
 
-		log.Printf("Finished client -> server copy for %s (%d bytes)", targetHost, bytesCopied)
-	}()
+		if !routeRequest(req, scheme, targetHost, host) {
+			log.Printf("Cannot determine target for %s: no Host header", clientConn.RemoteAddr())
+			fmt.Fprintf(clientConn, "HTTP/1.1 400 Bad Request\r\nConnection: close\r\n\r\nInvalid target host.\r\n")
+			return
+		}
+		log.Printf("Intercepted %s %s %s", strings.ToUpper(scheme), req.Method, req.URL.String())
 
-	go func() {
-		defer wg.Done()
-		bytesCopied, err := io.Copy(tlsClientConn, tlsServerConn)
-		if err != nil && err != io.EOF && !strings.Contains(err.Error(), "use of closed network connection") {
-			log.Printf("Error copying server to client (%s): %v (%d bytes)", targetHost, err, bytesCopied)
+		if !p.serveRequest(clientConn, clientReader, req, f) {
+			return
 		}
+	}
+}
 
-		if err = tlsClientConn.CloseWrite(); err != nil {
-			if !strings.Contains(err.Error(), "use of closed network connection") {
-				log.Printf("Error calling CloseWrite on client connection (%s): %v", targetHost, err)
-			}
+// routeRequest направляет запрос из туннеля на сервер назначения: targetHost,
+// а если он пуст — хост из заголовка Host. Возвращает false, если цель
+// определить нельзя.
+func routeRequest(req *http.Request, scheme, targetHost, host string) bool {
+	target := targetHost
+	if target == "" {
+		if req.Host == "" {
+			return false
 		}
-		log.Printf("Finished server -> client copy for %s (%d bytes)", targetHost, bytesCopied)
-	}()
+		target = req.Host
+		if _, _, err := net.SplitHostPort(target); err != nil {
+			target = net.JoinHostPort(target, defaultPorts[scheme])
+		}
+	}
 
-	wg.Wait()
-	log.Printf("Data relay finished for %s", targetHost)
+	req.URL.Scheme = scheme
+	// соединяемся с целью туннеля, а не с тем, что клиент написал в Host
+	req.URL.Host = strings.TrimSuffix(target, ":"+defaultPorts[scheme])
+	if req.Host == "" {
+		req.Host = host
+	}
+
+	return true
 }
+
+var defaultPorts = map[string]string{"http": "80", "https": "443"}
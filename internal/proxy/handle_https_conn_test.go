@@ -0,0 +1,133 @@
+package proxy
+
+import (
+	"bufio"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/goriiin/go-proxy/internal/ca"
+	"github.com/goriiin/go-proxy/internal/scope"
+	"github.com/goriiin/go-proxy/internal/upstream"
+)
+
+// testCA выпускает самоподписанный CA для теста.
+func testCA(t *testing.T, name string) tls.Certificate {
+	t.Helper()
+
+	certPEM, keyPEM, err := ca.Create(ca.Options{CommonName: name, KeyType: ca.KeyECDSAP256, Validity: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cert.Leaf == nil {
+		cert.Leaf, _ = x509.ParseCertificate(cert.Certificate[0])
+	}
+
+	return cert
+}
+
+// testLeaf выпускает сертификат сервера только для имени dnsName, без IP в SAN.
+func testLeaf(t *testing.T, issuer tls.Certificate, dnsName string) tls.Certificate {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: dnsName},
+		DNSNames:     []string{dnsName},
+		NotBefore:    time.Now().Add(-time.Minute),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, issuer.Leaf, key.Public(), issuer.PrivateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+// CONNECT к IP с SNI: прокси соединяется с IP, но серверу представляется
+// именем из SNI и проверяет его сертификат по этому имени.
+func TestConnectToIPWithSNI(t *testing.T) {
+	upstreamCA := testCA(t, "upstream CA")
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "sni=%s", r.TLS.ServerName)
+	}))
+	server.TLS = &tls.Config{Certificates: []tls.Certificate{testLeaf(t, upstreamCA, "upstream.test")}}
+	server.StartTLS()
+	defer server.Close()
+
+	rootFile := filepath.Join(t.TempDir(), "upstream-ca.crt")
+	if err := os.WriteFile(rootFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: upstreamCA.Certificate[0]}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	// запись истории не нужна: все пути вне scope, но TLS расшифровывается
+	sp := &scope.Scope{}
+	if err := sp.Set(scope.Config{Exclude: []scope.Rule{{Path: "."}}}); err != nil {
+		t.Fatal(err)
+	}
+	proxyCA := testCA(t, "proxy CA")
+	p, err := New(proxyCA, nil, Options{
+		Upstream:    upstream.Options{TLS: []upstream.TLSProfile{{Host: "*", RootCAs: []string{rootFile}}}},
+		Scope:       sp,
+		LeafKeyType: KeyECDSAP256,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client, conn := net.Pipe()
+	defer client.Close()
+	target := server.Listener.Addr().String()
+	go func() {
+		defer conn.Close()
+		p.handleHTTPSConnect(conn, target, &flow{})
+	}()
+
+	reader := bufio.NewReader(client)
+	connectResp, err := http.ReadResponse(reader, &http.Request{Method: http.MethodConnect})
+	if err != nil || connectResp.StatusCode != http.StatusOK {
+		t.Fatalf("CONNECT response = %v, %v", connectResp, err)
+	}
+
+	roots := x509.NewCertPool()
+	roots.AddCert(proxyCA.Leaf)
+	tlsConn := tls.Client(client, &tls.Config{ServerName: "upstream.test", RootCAs: roots})
+	req, _ := http.NewRequest(http.MethodGet, "https://upstream.test/", nil)
+	if err := req.Write(tlsConn); err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.ReadResponse(bufio.NewReader(tlsConn), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK || string(body) != "sni=upstream.test" {
+		t.Errorf("response = %s %q, want 200 %q", resp.Status, body, "sni=upstream.test")
+	}
+}
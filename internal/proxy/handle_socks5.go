@@ -0,0 +1,295 @@
+package proxy
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"strconv"
+	"time"
+)
+
+const (
+	socks5Version = 0x05
+
+	socks5AuthNone         = 0x00
+	socks5AuthPassword     = 0x02
+	socks5AuthNoAcceptable = 0xff
+
+	socks5CmdConnect = 0x01
+
+	socks5AddrIPv4   = 0x01
+	socks5AddrDomain = 0x03
+	socks5AddrIPv6   = 0x04
+
+	socks5Succeeded           = 0x00
+	socks5CmdNotSupported     = 0x07
+	socks5AddrTypeUnsupported = 0x08
+
+	// sniffTimeout — сколько ждать первых байт клиента, прежде чем решить,
+	// что протокол «сервер говорит первым», и туннелировать его как есть.
+	sniffTimeout = 2 * time.Second
+)
+
+// httpMethods — начала запросов, по которым поток внутри SOCKS5 считается HTTP.
+var httpMethods = []string{"GET ", "POST ", "PUT ", "HEAD ", "DELETE ", "OPTIONS ", "PATCH ", "TRACE ", "CONNECT "}
+
+// HandleSOCKS5 обслуживает клиента, подключившегося по SOCKS5 (RFC 1928).
+// HTTP и TLS внутри CONNECT идут в тот же конвейер перехвата, что и у
+// HTTP-прокси, остальные протоколы туннелируются без изменений.
+func (p *Proxy) HandleSOCKS5(clientConn net.Conn) {
+	defer func(clientConn net.Conn) {
+		err := clientConn.Close()
+		if err != nil && !errors.Is(err, net.ErrClosed) {
+			log.Printf("Failed to close SOCKS5 client connection: %v", err)
+		}
+	}(clientConn)
+
+	if !p.auth.AllowedAddr(clientConn.RemoteAddr()) {
+		log.Printf("SOCKS5 client %s is not in the allowlist", clientConn.RemoteAddr())
+		return
+	}
+
+	_ = clientConn.SetDeadline(time.Now().Add(30 * time.Second))
+	reader := bufio.NewReader(clientConn)
+
+	targetHost, user, err := p.socks5Handshake(clientConn, reader)
+	if err != nil {
+		log.Printf("SOCKS5 handshake with %s failed: %v", clientConn.RemoteAddr(), err)
+		return
+	}
+	_ = clientConn.SetDeadline(time.Time{})
+	log.Printf("SOCKS5 CONNECT to %s from %s", targetHost, clientConn.RemoteAddr())
+
+	p.dispatchTunnel(newBufferedConn(clientConn, reader), targetHost, &flow{user: user})
+}
+
+// dispatchTunnel смотрит на первые байты клиента и выбирает обработчик:
+// TLS с HTTP внутри — перехват с поддельным сертификатом, HTTP — разбор запросов,
+// всё остальное — сырой туннель. targetHost может быть пустым, тогда
+// цель берётся из SNI или заголовка Host; если он известен, соединение
+// идёт именно туда, что бы клиент ни прислал в SNI.
+func (p *Proxy) dispatchTunnel(clientConn net.Conn, targetHost string, f *flow) {
+	reader := bufio.NewReader(clientConn)
+
+	_ = clientConn.SetReadDeadline(time.Now().Add(sniffTimeout))
+	first, err := reader.Peek(1)
+	_ = clientConn.SetReadDeadline(time.Time{})
+	conn := newBufferedConn(clientConn, reader)
+
+	switch {
+	case err == nil && first[0] == 0x16: // TLS handshake record
+		hello, conn := peekClientHello(clientConn, reader)
+		serverName := ""
+		if hello != nil {
+			serverName = hello.ServerName
+		}
+		if targetHost == "" && serverName != "" {
+			// адреса назначения нет — остаётся только имя из SNI
+			targetHost = serverName
+		}
+		if targetHost == "" {
+			log.Printf("Cannot determine TLS target for %s: no SNI", clientConn.RemoteAddr())
+			return
+		}
+
+		// подключаемся к исходному адресу назначения; SNI влияет только на
+		// сертификат и на проверки passthrough и scope
+		targetHost, host := splitTarget(targetHost, "443")
+		if !httpOverTLS(hello, targetHost) {
+			// IMAPS, XMPP и прочий не-HTTP TLS расшифровывать незачем
+			log.Printf("TLS to %s does not carry HTTP, tunnelling without interception", targetHost)
+			p.relayRaw(conn, targetHost)
+			return
+		}
+		if reason := p.skipTLSFor(host, targetHost, serverName); reason != "" {
+			log.Printf("%s (SNI %q) is %s, tunnelling without interception", targetHost, serverName, reason)
+			p.relayRaw(conn, targetHost)
+			return
+		}
+		p.interceptTLS(conn, targetHost, host, f)
+	case err == nil && looksLikeHTTP(reader) && !(targetHost != "" && p.scope.Tunnel("http", targetHost)):
+		host := ""
+		if targetHost != "" {
+			targetHost, host = splitTarget(targetHost, "80")
+		}
+		p.relayRequests(conn, "http", targetHost, host, f)
+	case targetHost != "":
+		p.relayRaw(conn, targetHost)
+	default:
+		log.Printf("Cannot determine target for %s: unknown protocol", clientConn.RemoteAddr())
+	}
+}
+
+// httpTLSPorts — порты, на которых TLS без ALPN считается HTTPS.
+var httpTLSPorts = map[string]bool{"443": true, "8443": true}
+
+// httpOverTLS решает по ClientHello, пойдёт ли внутри TLS HTTP: клиент
+// предлагает h2 или http/1.x через ALPN, а если ALPN нет — порт назначения
+// из httpTLSPorts.
+func httpOverTLS(hello *tls.ClientHelloInfo, targetHost string) bool {
+	if hello == nil {
+		return false
+	}
+	if len(hello.SupportedProtos) > 0 {
+		for _, proto := range hello.SupportedProtos {
+			if proto == "h2" || proto == "http/1.1" || proto == "http/1.0" {
+				return true
+			}
+		}
+
+		return false
+	}
+
+	_, port, err := net.SplitHostPort(targetHost)
+
+	return err == nil && httpTLSPorts[port]
+}
+
+func looksLikeHTTP(reader *bufio.Reader) bool {
+	head, _ := reader.Peek(reader.Buffered())
+	for _, m := range httpMethods {
+		n := min(len(m), len(head))
+		if n > 0 && string(head[:n]) == m[:n] {
+			return true
+		}
+	}
+
+	return false
+}
+
+// socks5Handshake согласует метод аутентификации, читает команду CONNECT
+// и отвечает клиенту. Возвращает адрес назначения host:port и имя
+// пользователя, если прокси требует пароль.
+func (p *Proxy) socks5Handshake(conn net.Conn, reader *bufio.Reader) (string, string, error) {
+	head := make([]byte, 2)
+	if _, err := io.ReadFull(reader, head); err != nil {
+		return "", "", err
+	}
+	if head[0] != socks5Version {
+		return "", "", fmt.Errorf("unsupported SOCKS version %d", head[0])
+	}
+	methods := make([]byte, head[1])
+	if _, err := io.ReadFull(reader, methods); err != nil {
+		return "", "", err
+	}
+
+	want := byte(socks5AuthNone)
+	if p.auth.RequiresPassword() {
+		want = socks5AuthPassword
+	}
+	if bytes.IndexByte(methods, want) < 0 {
+		_, _ = conn.Write([]byte{socks5Version, socks5AuthNoAcceptable})
+		return "", "", errors.New("client offers no acceptable auth method")
+	}
+	if _, err := conn.Write([]byte{socks5Version, want}); err != nil {
+		return "", "", err
+	}
+
+	var user string
+	if want == socks5AuthPassword {
+		var err error
+		if user, err = p.socks5Password(conn, reader); err != nil {
+			return "", "", err
+		}
+	}
+
+	req := make([]byte, 4)
+	if _, err := io.ReadFull(reader, req); err != nil {
+		return "", "", err
+	}
+	if req[0] != socks5Version {
+		return "", "", fmt.Errorf("unsupported SOCKS version %d", req[0])
+	}
+	if req[1] != socks5CmdConnect {
+		socks5Reply(conn, socks5CmdNotSupported)
+		return "", "", fmt.Errorf("unsupported SOCKS command %d", req[1])
+	}
+
+	var host string
+	switch req[3] {
+	case socks5AddrIPv4, socks5AddrIPv6:
+		ip := make([]byte, net.IPv4len)
+		if req[3] == socks5AddrIPv6 {
+			ip = make([]byte, net.IPv6len)
+		}
+		if _, err := io.ReadFull(reader, ip); err != nil {
+			return "", "", err
+		}
+		host = net.IP(ip).String()
+	case socks5AddrDomain:
+		l, err := reader.ReadByte()
+		if err != nil {
+			return "", "", err
+		}
+		name := make([]byte, l)
+		if _, err = io.ReadFull(reader, name); err != nil {
+			return "", "", err
+		}
+		host = string(name)
+	default:
+		socks5Reply(conn, socks5AddrTypeUnsupported)
+		return "", "", fmt.Errorf("unsupported SOCKS address type %d", req[3])
+	}
+
+	port := make([]byte, 2)
+	if _, err := io.ReadFull(reader, port); err != nil {
+		return "", "", err
+	}
+
+	if err := socks5Reply(conn, socks5Succeeded); err != nil {
+		return "", "", err
+	}
+
+	return net.JoinHostPort(host, strconv.Itoa(int(binary.BigEndian.Uint16(port)))), user, nil
+}
+
+// socks5Password проверяет логин и пароль клиента (RFC 1929).
+func (p *Proxy) socks5Password(conn net.Conn, reader *bufio.Reader) (string, error) {
+	ver, err := reader.ReadByte()
+	if err != nil {
+		return "", err
+	}
+	if ver != 0x01 {
+		return "", fmt.Errorf("unsupported SOCKS auth version %d", ver)
+	}
+
+	readField := func() (string, error) {
+		l, err := reader.ReadByte()
+		if err != nil {
+			return "", err
+		}
+		b := make([]byte, l)
+		_, err = io.ReadFull(reader, b)
+		return string(b), err
+	}
+	user, err := readField()
+	if err != nil {
+		return "", err
+	}
+	pass, err := readField()
+	if err != nil {
+		return "", err
+	}
+
+	if !p.auth.Check(user, pass) {
+		_, _ = conn.Write([]byte{0x01, 0x01})
+		return "", fmt.Errorf("authentication failed for user %q", user)
+	}
+	if _, err = conn.Write([]byte{0x01, 0x00}); err != nil {
+		return "", err
+	}
+
+	return user, nil
+}
+
+// socks5Reply отправляет ответ на команду; адрес привязки всегда 0.0.0.0:0.
+func socks5Reply(conn net.Conn, code byte) error {
+	_, err := conn.Write([]byte{socks5Version, code, 0x00, socks5AddrIPv4, 0, 0, 0, 0, 0, 0})
+	return err
+}
@@ -0,0 +1,148 @@
+package proxy
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/tls"
+	"io"
+	"net"
+	"testing"
+)
+
+func TestSOCKS5Handshake(t *testing.T) {
+	withPassword := &Auth{users: map[string]string{"alice": "secret"}}
+	connectOK := []byte{5, 0, 0, 1, 0, 0, 0, 0, 0, 0}
+	cat := func(parts ...[]byte) []byte { return bytes.Join(parts, nil) }
+
+	tests := []struct {
+		name      string
+		auth      *Auth
+		in        []byte
+		want      string
+		wantUser  string
+		wantReply []byte
+		wantErr   bool
+	}{
+		{
+			name:      "ipv4",
+			in:        []byte{5, 1, 0, 5, 1, 0, 1, 10, 0, 0, 1, 0x01, 0xbb},
+			want:      "10.0.0.1:443",
+			wantReply: append([]byte{5, 0}, connectOK...),
+		},
+		{
+			name:      "ipv6",
+			in:        cat([]byte{5, 1, 0, 5, 1, 0, 4}, net.ParseIP("2001:db8::1"), []byte{0, 80}),
+			want:      "[2001:db8::1]:80",
+			wantReply: append([]byte{5, 0}, connectOK...),
+		},
+		{
+			name:      "domain",
+			in:        cat([]byte{5, 2, 2, 0, 5, 1, 0, 3, 11}, []byte("example.com"), []byte{0x1f, 0x90}),
+			want:      "example.com:8080",
+			wantReply: append([]byte{5, 0}, connectOK...),
+		},
+		{
+			name:      "password",
+			auth:      withPassword,
+			in:        cat([]byte{5, 1, 2, 1, 5}, []byte("alice"), []byte{6}, []byte("secret"), []byte{5, 1, 0, 1, 127, 0, 0, 1, 0, 80}),
+			want:      "127.0.0.1:80",
+			wantUser:  "alice",
+			wantReply: append([]byte{5, 2, 1, 0}, connectOK...),
+		},
+		{
+			name:      "wrong password",
+			auth:      withPassword,
+			in:        cat([]byte{5, 1, 2, 1, 5}, []byte("alice"), []byte{5}, []byte("wrong")),
+			wantReply: []byte{5, 2, 1, 1},
+			wantErr:   true,
+		},
+		{
+			// пароль обязателен, а клиент предлагает только «без аутентификации»
+			name:      "no acceptable method",
+			auth:      withPassword,
+			in:        []byte{5, 1, 0},
+			wantReply: []byte{5, 0xff},
+			wantErr:   true,
+		},
+		{
+			name:    "socks4",
+			in:      []byte{4, 1, 0, 80, 127, 0, 0, 1, 0},
+			wantErr: true,
+		},
+		{
+			name:      "bind",
+			in:        []byte{5, 1, 0, 5, 2, 0, 1, 127, 0, 0, 1, 0, 80},
+			wantReply: []byte{5, 0, 5, 7, 0, 1, 0, 0, 0, 0, 0, 0},
+			wantErr:   true,
+		},
+		{
+			name:      "unknown address type",
+			in:        []byte{5, 1, 0, 5, 1, 0, 9},
+			wantReply: []byte{5, 0, 5, 8, 0, 1, 0, 0, 0, 0, 0, 0},
+			wantErr:   true,
+		},
+		{
+			name:      "truncated",
+			in:        []byte{5, 1, 0, 5, 1, 0, 3, 11, 'e', 'x'},
+			wantReply: []byte{5, 0},
+			wantErr:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &Proxy{auth: tt.auth}
+			client, server := net.Pipe()
+			defer client.Close()
+
+			type result struct {
+				target, user string
+				err          error
+			}
+			done := make(chan result, 1)
+			go func() {
+				defer server.Close()
+				target, user, err := p.socks5Handshake(server, bufio.NewReader(bytes.NewReader(tt.in)))
+				done <- result{target, user, err}
+			}()
+
+			reply, _ := io.ReadAll(client)
+			res := <-done
+
+			if (res.err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", res.err, tt.wantErr)
+			}
+			if res.target != tt.want || res.user != tt.wantUser {
+				t.Errorf("target, user = %q, %q, want %q, %q", res.target, res.user, tt.want, tt.wantUser)
+			}
+			if !bytes.Equal(reply, tt.wantReply) {
+				t.Errorf("reply = %v, want %v", reply, tt.wantReply)
+			}
+		})
+	}
+}
+
+func TestHTTPOverTLS(t *testing.T) {
+	tests := []struct {
+		name   string
+		hello  *tls.ClientHelloInfo
+		target string
+		want   bool
+	}{
+		{"h2", &tls.ClientHelloInfo{SupportedProtos: []string{"h2", "http/1.1"}}, "10.0.0.1:993", true},
+		{"http/1.1", &tls.ClientHelloInfo{SupportedProtos: []string{"http/1.1"}}, "10.0.0.1:9000", true},
+		{"other alpn on 443", &tls.ClientHelloInfo{SupportedProtos: []string{"imap"}}, "10.0.0.1:443", false},
+		{"no alpn on 443", &tls.ClientHelloInfo{}, "10.0.0.1:443", true},
+		{"no alpn on 8443", &tls.ClientHelloInfo{}, "10.0.0.1:8443", true},
+		{"no alpn on 993", &tls.ClientHelloInfo{}, "10.0.0.1:993", false},
+		{"no hello", nil, "10.0.0.1:443", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := httpOverTLS(tt.hello, tt.target); got != tt.want {
+				t.Errorf("httpOverTLS() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
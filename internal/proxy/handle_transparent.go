@@ -0,0 +1,65 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net"
+)
+
+// HandleTransparent обслуживает соединение, перенаправленное на прокси
+// правилом iptables (REDIRECT или TPROXY): клиент не знает о прокси и
+// не присылает CONNECT. Адрес назначения восстанавливается из
+// SO_ORIGINAL_DST, локального адреса сокета (TPROXY) либо из SNI/Host.
+func (p *Proxy) HandleTransparent(clientConn net.Conn) {
+	defer func(clientConn net.Conn) {
+		err := clientConn.Close()
+		if err != nil && !errors.Is(err, net.ErrClosed) {
+			log.Printf("Failed to close transparent client connection: %v", err)
+		}
+	}(clientConn)
+
+	if !p.auth.AllowedAddr(clientConn.RemoteAddr()) {
+		log.Printf("Transparent client %s is not in the allowlist", clientConn.RemoteAddr())
+		return
+	}
+
+	targetHost := p.transparentTarget(clientConn)
+	if targetHost != "" {
+		log.Printf("Transparent connection from %s to %s", clientConn.RemoteAddr(), targetHost)
+	} else {
+		log.Printf("Transparent connection from %s, original destination unknown", clientConn.RemoteAddr())
+	}
+
+	// в прозрачном режиме клиент не может представиться, поэтому
+	// действует только список разрешённых адресов
+	p.dispatchTunnel(clientConn, targetHost, &flow{})
+}
+
+// transparentTarget возвращает исходный адрес назначения или "",
+// если клиент подключился к прокси напрямую.
+func (p *Proxy) transparentTarget(clientConn net.Conn) string {
+	local := clientConn.LocalAddr().String()
+
+	dst, err := originalDst(clientConn)
+	if err == nil && dst != local {
+		return dst
+	}
+	if p.tproxy {
+		// при TPROXY сокет принимается с адресом исходного назначения
+		return local
+	}
+
+	return ""
+}
+
+// ListenTransparent открывает слушатель для прозрачного режима;
+// в режиме TPROXY на сокете включается IP_TRANSPARENT.
+func (p *Proxy) ListenTransparent(addr string) (net.Listener, error) {
+	lc := net.ListenConfig{}
+	if p.tproxy {
+		lc.Control = setTransparent
+	}
+
+	return lc.Listen(context.Background(), "tcp", addr)
+}
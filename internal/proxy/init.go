@@ -1,23 +1,169 @@
 package proxy
 
 import (
+	"crypto/sha256"
 	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"github.com/goriiin/go-proxy/internal/ca"
+	"github.com/goriiin/go-proxy/internal/certcache"
+	"github.com/goriiin/go-proxy/internal/domain"
+	"github.com/goriiin/go-proxy/internal/intercept"
+	"github.com/goriiin/go-proxy/internal/rewrite"
+	"github.com/goriiin/go-proxy/internal/scope"
 	"github.com/goriiin/go-proxy/internal/store"
-	"sync"
+	"github.com/goriiin/go-proxy/internal/upstream"
+	"time"
+)
+
+// Options — настраиваемые параметры прокси.
+type Options struct {
+	// IdleTimeout — сколько ждать следующего запроса на keep-alive соединении клиента.
+	IdleTimeout time.Duration
+	// Upstream — пул соединений к серверам назначения.
+	Upstream upstream.Options
+	// TProxy — прозрачный слушатель работает как цель iptables TPROXY, а не REDIRECT.
+	TProxy bool
+	// Auth — проверка клиентов; nil — прокси открыт для всех.
+	Auth *Auth
+	// Intercept — точки останова для запросов и ответов; nil — без перехвата.
+	Intercept *intercept.Interceptor
+	// Rewrite — правила Match & Replace; nil — трафик не меняется.
+	Rewrite *rewrite.Engine
+	// Scope — что записывать и расшифровывать; nil — всё.
+	Scope *scope.Scope
+	// Passthrough — хосты, TLS которых не расшифровывается; nil — расшифровывать всё.
+	Passthrough *Passthrough
+	// MirrorCert — копировать в поддельный сертификат субъект, SAN и срок
+	// действия настоящего, а не только его имена.
+	MirrorCert bool
+	// CertCacheSize — сколько поддельных сертификатов держать в памяти.
+	CertCacheSize int
+	// CertStore — где хранить сертификаты между запусками; nil — только в памяти.
+	CertStore certcache.Backend
+	// LeafKeyType — тип ключей поддельных сертификатов: rsa2048, ecdsa-p256, ed25519.
+	LeafKeyType string
+	// LeafKeyPool — сколько ключей сгенерировать заранее и переиспользовать;
+	// 0 — новый ключ для каждого сертификата.
+	LeafKeyPool int
+	// DisableHTTP2 — не предлагать клиенту h2 в ALPN при расшифровке TLS.
+	DisableHTTP2 bool
+	// BodyLimit — сколько байт тела запроса и ответа сохранять в истории;
+	// 0 — defaultBodyLimit. Клиенту тело отдаётся целиком в любом случае.
+	BodyLimit int
+}
+
+const (
+	defaultIdleTimeout   = 90 * time.Second
+	defaultCertCacheSize = 10000
+	defaultBodyLimit     = 1 << 20
+	// wsRecordQueue — сколько сообщений WebSocket ждут записи в хранилище.
+	wsRecordQueue = 1024
 )
 
 type Proxy struct {
-	certCache map[string]*tls.Certificate
-	mu        sync.Mutex
-	caCert    tls.Certificate
-	store     *store.Store
+	certCache   *certcache.Cache
+	leafKeys    *leafKeys
+	caCert      tls.Certificate
+	caChain     [][]byte          // промежуточные CA, которые отдаются вместе с листом
+	caAnchor    *x509.Certificate // корень, который устанавливают на устройства
+	store       *store.Store
+	idleTimeout time.Duration
+	transport   *upstream.Transport
+	tproxy      bool
+	auth        *Auth
+	intercept   *intercept.Interceptor
+	rewrite     *rewrite.Engine
+	scope       *scope.Scope
+	passthrough *Passthrough
+	mirrorCert  bool
+	http2       bool
+	webSockets  *WebSockets
+	wsRecords   chan domain.WSMessage // см. saveWSMessage
+	bodyLimit   int
+	certProfile string // см. newCertProfile
+}
+
+func New(cert tls.Certificate, s *store.Store, opts Options) (*Proxy, error) {
+	if opts.IdleTimeout <= 0 {
+		opts.IdleTimeout = defaultIdleTimeout
+	}
+	if opts.CertCacheSize <= 0 {
+		opts.CertCacheSize = defaultCertCacheSize
+	}
+	if opts.BodyLimit <= 0 {
+		opts.BodyLimit = defaultBodyLimit
+	}
+	keys, err := newLeafKeys(opts.LeafKeyType, opts.LeafKeyPool)
+	if err != nil {
+		return nil, err
+	}
+	chain, anchor, err := ca.SplitChain(cert.Certificate)
+	if err != nil {
+		return nil, err
+	}
+	transport, err := upstream.New(opts.Upstream)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &Proxy{
+		certCache:   certcache.New(opts.CertCacheSize, opts.CertStore),
+		leafKeys:    keys,
+		caCert:      cert,
+		caChain:     chain,
+		caAnchor:    anchor,
+		store:       s,
+		idleTimeout: opts.IdleTimeout,
+		transport:   transport,
+		tproxy:      opts.TProxy,
+		auth:        opts.Auth,
+		intercept:   opts.Intercept,
+		rewrite:     opts.Rewrite,
+		scope:       opts.Scope,
+		passthrough: opts.Passthrough,
+		mirrorCert:  opts.MirrorCert,
+		http2:       !opts.DisableHTTP2,
+		bodyLimit:   opts.BodyLimit,
+		certProfile: newCertProfile(cert.Leaf, keys.keyType, opts.MirrorCert),
+	}
+	p.webSockets = &WebSockets{sessions: make(map[uint64]*WSSession), save: p.saveWSMessage}
+	p.wsRecords = make(chan domain.WSMessage, wsRecordQueue)
+	go p.recordWSMessages()
+
+	return p, nil
 }
 
-func New(cert tls.Certificate, s *store.Store) *Proxy {
-	return &Proxy{
-		certCache: make(map[string]*tls.Certificate),
-		mu:        sync.Mutex{},
-		caCert:    cert,
-		store:     s,
+// newCertProfile — отпечаток подписывающего CA и параметры выпуска листьев.
+// Смена CA (gen-ca, автогенерация, промежуточный CA), типа ключа или
+// -mirror-upstream-cert даёт другой профиль, и сохранённые ранее сертификаты
+// больше не находятся в кеше — клиенты их бы всё равно отвергли.
+func newCertProfile(caLeaf *x509.Certificate, keyType string, mirror bool) string {
+	sum := sha256.Sum256(caLeaf.Raw)
+	profile := hex.EncodeToString(sum[:8]) + "-" + keyType
+	if mirror {
+		profile += "-mirror"
 	}
+
+	return profile
+}
+
+// Transport — общий транспорт к серверам назначения; его же использует сканер.
+func (p *Proxy) Transport() *upstream.Transport {
+	return p.transport
+}
+
+// CertCache — кеш поддельных сертификатов (статистика и сброс через API).
+func (p *Proxy) CertCache() *certcache.Cache {
+	return p.certCache
+}
+
+// WebSockets — открытые соединения WebSocket (просмотр и отправка сообщений через API).
+func (p *Proxy) WebSockets() *WebSockets {
+	return p.webSockets
+}
+
+// CA — корневой сертификат, которому должны доверять клиенты.
+func (p *Proxy) CA() *x509.Certificate {
+	return p.caAnchor
 }
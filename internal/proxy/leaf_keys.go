@@ -0,0 +1,62 @@
+package proxy
+
+import (
+	"crypto"
+	"fmt"
+	"sync"
+
+	"github.com/goriiin/go-proxy/internal/ca"
+)
+
+// Типы ключей поддельных сертификатов.
+const (
+	KeyRSA2048   = ca.KeyRSA2048
+	KeyECDSAP256 = ca.KeyECDSAP256
+	KeyEd25519   = ca.KeyEd25519
+)
+
+// leafKeys выдаёт ключи для поддельных сертификатов. С пулом ключи
+// генерируются заранее и переиспользуются по кругу — выпуск сертификата
+// для нового хоста сводится к одной подписи CA.
+type leafKeys struct {
+	keyType string
+
+	mu   sync.Mutex
+	pool []crypto.Signer
+	next int
+}
+
+func newLeafKeys(keyType string, poolSize int) (*leafKeys, error) {
+	if keyType == "" {
+		keyType = KeyRSA2048
+	}
+	switch keyType {
+	case KeyRSA2048, KeyECDSAP256, KeyEd25519:
+	default:
+		return nil, fmt.Errorf("unknown key type %q", keyType)
+	}
+	k := &leafKeys{keyType: keyType}
+	for i := 0; i < poolSize; i++ {
+		key, err := ca.GenerateKey(keyType)
+		if err != nil {
+			return nil, err
+		}
+		k.pool = append(k.pool, key)
+	}
+
+	return k, nil
+}
+
+// get возвращает ключ из пула или новый, если пул не задан.
+func (k *leafKeys) get() (crypto.Signer, error) {
+	if len(k.pool) == 0 {
+		return ca.GenerateKey(k.keyType)
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	key := k.pool[k.next]
+	k.next = (k.next + 1) % len(k.pool)
+
+	return key, nil
+}
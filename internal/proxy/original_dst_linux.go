@@ -0,0 +1,58 @@
+//go:build linux
+
+package proxy
+
+import (
+	"errors"
+	"net"
+	"strconv"
+	"syscall"
+)
+
+// soOriginalDst — SO_ORIGINAL_DST из linux/netfilter_ipv4.h.
+const soOriginalDst = 80
+
+// originalDst читает адрес, на который клиент подключался до REDIRECT в iptables.
+// Поддерживается только IPv4.
+func originalDst(conn net.Conn) (string, error) {
+	tcpConn, ok := conn.(*net.TCPConn)
+	if !ok {
+		return "", errors.New("original dst: not a TCP connection")
+	}
+	raw, err := tcpConn.SyscallConn()
+	if err != nil {
+		return "", err
+	}
+
+	var addr string
+	var sockErr error
+	err = raw.Control(func(fd uintptr) {
+		// sockaddr_in помещается в IPv6Mreq, поэтому используем его getsockopt
+		mreq, err := syscall.GetsockoptIPv6Mreq(int(fd), syscall.IPPROTO_IP, soOriginalDst)
+		if err != nil {
+			sockErr = err
+			return
+		}
+		port := int(mreq.Multiaddr[2])<<8 | int(mreq.Multiaddr[3])
+		ip := net.IPv4(mreq.Multiaddr[4], mreq.Multiaddr[5], mreq.Multiaddr[6], mreq.Multiaddr[7])
+		addr = net.JoinHostPort(ip.String(), strconv.Itoa(port))
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return addr, sockErr
+}
+
+// setTransparent включает IP_TRANSPARENT на слушающем сокете для TPROXY.
+func setTransparent(network, address string, c syscall.RawConn) error {
+	var sockErr error
+	err := c.Control(func(fd uintptr) {
+		sockErr = syscall.SetsockoptInt(int(fd), syscall.SOL_IP, syscall.IP_TRANSPARENT, 1)
+	})
+	if err != nil {
+		return err
+	}
+
+	return sockErr
+}
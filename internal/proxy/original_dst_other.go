@@ -0,0 +1,19 @@
+//go:build !linux
+
+package proxy
+
+import (
+	"errors"
+	"net"
+	"syscall"
+)
+
+var errTransparentUnsupported = errors.New("transparent proxying is supported only on linux")
+
+func originalDst(conn net.Conn) (string, error) {
+	return "", errTransparentUnsupported
+}
+
+func setTransparent(network, address string, c syscall.RawConn) error {
+	return errTransparentUnsupported
+}
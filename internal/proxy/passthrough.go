@@ -0,0 +1,246 @@
+package proxy
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// PassthroughEntry — хост (или glob), TLS которого не расшифровывается.
+type PassthroughEntry struct {
+	Host  string    `json:"host"`
+	Auto  bool      `json:"auto"` // добавлен после неудачных рукопожатий
+	Added time.Time `json:"added"`
+	// Expires — когда автоматически добавленный хост снова начнёт расшифровываться.
+	Expires time.Time `json:"expires,omitempty"`
+}
+
+// expired — срок записи вышел; у добавленных вручную срока нет.
+func (e PassthroughEntry) expired(now time.Time) bool {
+	return !e.Expires.IsZero() && now.After(e.Expires)
+}
+
+// Passthrough — список хостов, для которых туннель пропускается как есть:
+// приложения с certificate pinning и домены, которые нельзя расшифровывать.
+// Хост попадает в список и автоматически, если клиент несколько раз подряд
+// отвергает поддельный сертификат, — на время autoTTL.
+type Passthrough struct {
+	mu       sync.Mutex
+	hosts    map[string]PassthroughEntry
+	failures map[string]int
+	after    int
+	autoTTL  time.Duration
+}
+
+// NewPassthrough создаёт список из hosts; after — после скольких отказов
+// от сертификата подряд хост добавляется сам (0 — не добавлять), autoTTL —
+// на сколько (0 — пока его не уберут через API).
+func NewPassthrough(hosts []string, after int, autoTTL time.Duration) (*Passthrough, error) {
+	pt := &Passthrough{
+		hosts:    map[string]PassthroughEntry{},
+		failures: map[string]int{},
+		after:    after,
+		autoTTL:  autoTTL,
+	}
+	for _, h := range hosts {
+		if strings.TrimSpace(h) == "" {
+			continue
+		}
+		if err := pt.Add(h); err != nil {
+			return nil, err
+		}
+	}
+
+	return pt, nil
+}
+
+// Add добавляет хост или glob вида *.bank.example.
+func (pt *Passthrough) Add(host string) error {
+	host = strings.ToLower(strings.TrimSpace(host))
+	if host == "" {
+		return fmt.Errorf("empty host")
+	}
+	if _, err := path.Match(host, ""); err != nil {
+		return fmt.Errorf("bad host pattern %q: %w", host, err)
+	}
+
+	pt.mu.Lock()
+	defer pt.mu.Unlock()
+	pt.hosts[host] = PassthroughEntry{Host: host, Added: time.Now()}
+	delete(pt.failures, host)
+
+	return nil
+}
+
+// Remove убирает хост из списка и сбрасывает счётчик его ошибок.
+func (pt *Passthrough) Remove(host string) bool {
+	host = strings.ToLower(strings.TrimSpace(host))
+
+	pt.mu.Lock()
+	defer pt.mu.Unlock()
+	_, ok := pt.hosts[host]
+	delete(pt.hosts, host)
+	delete(pt.failures, host)
+
+	return ok
+}
+
+// ClearAuto убирает все автоматически добавленные хосты и счётчики ошибок.
+// Возвращает, сколько хостов убрано.
+func (pt *Passthrough) ClearAuto() int {
+	pt.mu.Lock()
+	defer pt.mu.Unlock()
+
+	n := 0
+	for host, e := range pt.hosts {
+		if e.Auto {
+			delete(pt.hosts, host)
+			n++
+		}
+	}
+	clear(pt.failures)
+
+	return n
+}
+
+// List возвращает список, отсортированный по хосту.
+func (pt *Passthrough) List() []PassthroughEntry {
+	if pt == nil {
+		return nil
+	}
+
+	pt.mu.Lock()
+	defer pt.mu.Unlock()
+	pt.dropExpired()
+	out := make([]PassthroughEntry, 0, len(pt.hosts))
+	for _, e := range pt.hosts {
+		out = append(out, e)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Host < out[j].Host })
+
+	return out
+}
+
+// Match сообщает, что TLS для host нужно пропустить без расшифровки.
+func (pt *Passthrough) Match(host string) bool {
+	if pt == nil {
+		return false
+	}
+	host = strings.ToLower(host)
+
+	pt.mu.Lock()
+	defer pt.mu.Unlock()
+	if e, ok := pt.hosts[host]; ok {
+		if !e.expired(time.Now()) {
+			return true
+		}
+		delete(pt.hosts, host)
+		log.Printf("Automatic TLS passthrough for %s expired, intercepting it again", host)
+	}
+	for pattern := range pt.hosts {
+		if ok, _ := path.Match(pattern, host); ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+// dropExpired убирает записи с истёкшим сроком; вызывается под mu.
+func (pt *Passthrough) dropExpired() {
+	now := time.Now()
+	for host, e := range pt.hosts {
+		if e.expired(now) {
+			delete(pt.hosts, host)
+		}
+	}
+}
+
+// handshakeFailed учитывает неудачное рукопожатие с клиентом. Считаются
+// только отказы от сертификата (см. rejectedCertificate): обрыв связи или
+// несовпадение версий TLS про pinning ничего не говорят. Когда отказов
+// подряд набралось достаточно, хост добавляется в список.
+func (pt *Passthrough) handshakeFailed(host string, certRejected bool) {
+	if pt == nil || pt.after <= 0 || !certRejected {
+		return
+	}
+	host = strings.ToLower(host)
+
+	pt.mu.Lock()
+	defer pt.mu.Unlock()
+	pt.failures[host]++
+	if pt.failures[host] < pt.after {
+		return
+	}
+	delete(pt.failures, host)
+	now := time.Now()
+	e := PassthroughEntry{Host: host, Auto: true, Added: now}
+	if pt.autoTTL > 0 {
+		e.Expires = now.Add(pt.autoTTL)
+	}
+	pt.hosts[host] = e
+	log.Printf("Client rejected forged certificate for %s %d times, switching it to TLS passthrough", host, pt.after)
+}
+
+// certificateAlerts — алерты TLS, которыми клиент отвергает сертификат
+// (RFC 8446, раздел 6.2), и их текст в ошибках crypto/tls.
+var certificateAlerts = map[byte]string{
+	42: "tls: bad certificate",
+	43: "tls: unsupported certificate",
+	44: "tls: revoked certificate",
+	45: "tls: expired certificate",
+	46: "tls: unknown certificate",
+	48: "tls: unknown certificate authority",
+}
+
+// rejectedCertificate — клиент прервал рукопожатие алертом о сертификате.
+// Полученный алерт crypto/tls возвращает как "remote error" с
+// неэкспортированным типом, поэтому сравнивается текст. Клиент TLS 1.3
+// отправляет такой алерт открытым текстом, когда сервер уже ждёт
+// шифрованных записей, и crypto/tls сообщает только "bad record MAC" —
+// тогда алерт берётся из последней записи в прочитанных байтах handshake.
+func rejectedCertificate(err error, handshake []byte) bool {
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "remote error" && opErr.Err != nil {
+		for _, text := range certificateAlerts {
+			if opErr.Err.Error() == text {
+				return true
+			}
+		}
+		return false
+	}
+
+	var last []byte
+	for len(handshake) >= 5 {
+		n := 5 + int(binary.BigEndian.Uint16(handshake[3:5]))
+		if len(handshake) < n {
+			break
+		}
+		last, handshake = handshake[:n], handshake[n:]
+	}
+	// запись alert (21) открытым текстом: уровень и код
+	if len(last) != 7 || last[0] != 21 {
+		return false
+	}
+	_, ok := certificateAlerts[last[6]]
+
+	return ok
+}
+
+// handshakeSucceeded сбрасывает счётчик ошибок хоста.
+func (pt *Passthrough) handshakeSucceeded(host string) {
+	if pt == nil || pt.after <= 0 {
+		return
+	}
+
+	pt.mu.Lock()
+	defer pt.mu.Unlock()
+	delete(pt.failures, strings.ToLower(host))
+}
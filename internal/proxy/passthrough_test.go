@@ -0,0 +1,40 @@
+package proxy
+
+import (
+	"errors"
+	"io"
+	"net"
+	"testing"
+)
+
+func TestRejectedCertificate(t *testing.T) {
+	hello := []byte{22, 3, 1, 0, 4, 1, 0, 0, 0}
+	ccs := []byte{20, 3, 3, 0, 1, 1}
+	badMAC := &net.OpError{Op: "local error", Err: errors.New("tls: bad record MAC")}
+
+	tests := []struct {
+		name      string
+		err       error
+		handshake []byte
+		want      bool
+	}{
+		{"remote unknown ca", &net.OpError{Op: "remote error", Err: errors.New("tls: unknown certificate authority")}, nil, true},
+		{"remote bad certificate", &net.OpError{Op: "remote error", Err: errors.New("tls: bad certificate")}, nil, true},
+		{"remote protocol version", &net.OpError{Op: "remote error", Err: errors.New("tls: protocol version not supported")}, nil, false},
+		// TLS 1.3: алерт открытым текстом после ClientHello и ChangeCipherSpec
+		{"plaintext unknown ca", badMAC, append(append(hello, ccs...), 21, 3, 3, 0, 2, 2, 48), true},
+		{"plaintext certificate unknown", badMAC, append(hello, 21, 3, 3, 0, 2, 2, 46), true},
+		{"plaintext handshake failure", badMAC, append(hello, 21, 3, 3, 0, 2, 2, 40), false},
+		{"encrypted record", badMAC, append(hello, 23, 3, 3, 0, 3, 1, 2, 3), false},
+		{"incomplete alert", badMAC, append(hello, 21, 3, 3, 0, 2, 2), false},
+		{"client went away", io.EOF, hello, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := rejectedCertificate(tt.err, tt.handshake); got != tt.want {
+				t.Errorf("rejectedCertificate() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,107 @@
+package proxy
+
+import (
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/goriiin/go-proxy/internal/domain"
+	"github.com/goriiin/go-proxy/internal/sse"
+)
+
+// streamingTypes — ответы, которые сервер отдаёт порциями без конца:
+// их нельзя дочитывать до отправки клиенту.
+var streamingTypes = []string{
+	sse.ContentType,
+	"application/x-ndjson",
+	"application/stream+json",
+	"application/json-seq",
+	"multipart/x-mixed-replace",
+}
+
+// isStreaming — потоковый ответ (SSE, NDJSON, gRPC, MJPEG и т. п.).
+func isStreaming(resp *http.Response) bool {
+	ct, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if strings.HasPrefix(ct, "application/grpc") {
+		return true
+	}
+	for _, t := range streamingTypes {
+		if ct == t {
+			return true
+		}
+	}
+
+	return false
+}
+
+// isEventStream — ответ text/event-stream, события которого можно разобрать.
+func isEventStream(resp *http.Response) bool {
+	ct, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if ct != sse.ContentType {
+		return false
+	}
+	if enc := resp.Header.Get("Content-Encoding"); enc != "" && !strings.EqualFold(enc, "identity") {
+		log.Printf("Event stream is %s-encoded, events will not be recorded", enc)
+		return false
+	}
+
+	return true
+}
+
+// sseTap отдаёт поток событий без задержки и сохраняет каждое событие под
+// записью id. Разобранные события сохраняются при следующем чтении или
+// закрытии, то есть когда их байты уже ушли клиенту.
+type sseTap struct {
+	p       *Proxy
+	rc      io.ReadCloser
+	id      uint64
+	parser  sse.Parser
+	pending []domain.SSEEvent
+}
+
+func (p *Proxy) newSSETap(rc io.ReadCloser, id uint64) *sseTap {
+	return &sseTap{p: p, rc: rc, id: id}
+}
+
+func (t *sseTap) Read(b []byte) (int, error) {
+	t.flush()
+
+	n, err := t.rc.Read(b)
+	if n > 0 {
+		now := time.Now().UnixMilli()
+		for _, ev := range t.parser.Push(b[:n]) {
+			t.pending = append(t.pending, domain.SSEEvent{
+				RequestID: t.id,
+				ID:        ev.ID,
+				Event:     ev.Event,
+				Data:      ev.Data,
+				Retry:     ev.Retry,
+				TS:        now,
+			})
+		}
+	}
+
+	return n, err
+}
+
+func (t *sseTap) Close() error {
+	err := t.rc.Close()
+	t.flush()
+	log.Printf("Event stream closed (request id=%d)", t.id)
+
+	return err
+}
+
+func (t *sseTap) flush() {
+	for _, e := range t.pending {
+		if err := t.p.store.SaveSSEEvent(e); err != nil {
+			log.Printf("Failed to save SSE event for request id=%d: %v", t.id, err)
+			continue
+		}
+		log.Printf("Saved SSE event %q (%d bytes) for request id=%d", e.Event, len(e.Data), t.id)
+	}
+	t.pending = t.pending[:0]
+}
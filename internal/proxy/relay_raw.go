@@ -0,0 +1,62 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"sync"
+	"time"
+)
+
+// relayRaw соединяется с targetHost (с учётом вышестоящего прокси) и
+// перекачивает байты в обе стороны без разбора протокола.
+func (p *Proxy) relayRaw(clientConn net.Conn, targetHost string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	serverConn, err := p.transport.Dial(ctx, targetHost)
+	cancel()
+	if err != nil {
+		log.Printf("Failed to connect to target server %s: %v", targetHost, err)
+		return
+	}
+	defer func(serverConn net.Conn) {
+		err = serverConn.Close()
+		if err != nil && !errors.Is(err, net.ErrClosed) {
+			log.Printf("Failed to close target server connection: %v", err)
+		}
+	}(serverConn)
+	log.Printf("Relaying raw TCP for %s", targetHost)
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+
+	go func() {
+		defer wg.Done()
+		pipe(serverConn, clientConn, "client -> server", targetHost)
+	}()
+	go func() {
+		defer wg.Done()
+		pipe(clientConn, serverConn, "server -> client", targetHost)
+	}()
+
+	wg.Wait()
+	log.Printf("Raw relay finished for %s", targetHost)
+}
+
+// pipe копирует src в dst и закрывает запись в dst, когда src закончился.
+func pipe(dst, src net.Conn, direction, targetHost string) {
+	bytesCopied, err := io.Copy(dst, src)
+	if err != nil && !errors.Is(err, net.ErrClosed) {
+		log.Printf("Error copying %s (%s): %v (%d bytes)", direction, targetHost, err, bytesCopied)
+	}
+
+	if cw, ok := dst.(interface{ CloseWrite() error }); ok {
+		if err = cw.CloseWrite(); err != nil && !errors.Is(err, net.ErrClosed) {
+			log.Printf("Error calling CloseWrite %s (%s): %v", direction, targetHost, err)
+		}
+	} else {
+		_ = dst.Close()
+	}
+	log.Printf("Finished %s copy for %s (%d bytes)", direction, targetHost, bytesCopied)
+}
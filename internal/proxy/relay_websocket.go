@@ -0,0 +1,159 @@
+package proxy
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/goriiin/go-proxy/internal/domain"
+	"github.com/goriiin/go-proxy/internal/websocket"
+)
+
+// isWebSocketUpgrade — запрос HTTP/1.1 на переход к протоколу WebSocket.
+func isWebSocketUpgrade(req *http.Request) bool {
+	return req.ProtoMajor == 1 &&
+		hasToken(req.Header.Get("Connection"), "upgrade") &&
+		hasToken(req.Header.Get("Upgrade"), "websocket")
+}
+
+// relayWebSocket отдаёт клиенту 101 и пересылает кадры в обе стороны
+// без изменений, сохраняя каждое собранное сообщение под записью
+// рукопожатия id. При id == 0 (обмен вне scope) сообщения не сохраняются.
+func (p *Proxy) relayWebSocket(clientConn net.Conn, req *http.Request, resp *http.Response, id uint64) {
+	serverConn, ok := resp.Body.(io.ReadWriteCloser)
+	if !ok {
+		log.Printf("Upstream 101 for %s has no connection to relay", req.URL.String())
+		return
+	}
+
+	if err := writeSwitchingProtocols(clientConn, resp); err != nil {
+		log.Printf("Failed to write 101 to client for %s: %v", req.URL.String(), err)
+		return
+	}
+	log.Printf("WebSocket opened for %s (request id=%d)", req.URL.String(), id)
+
+	session := &WSSession{
+		ID:       id,
+		URL:      req.URL.String(),
+		Opened:   time.Now(),
+		toServer: newLockedWriter(serverConn),
+		toClient: newLockedWriter(clientConn),
+	}
+	if id != 0 {
+		p.webSockets.add(session)
+		defer p.webSockets.remove(id)
+	}
+
+	var wg sync.WaitGroup
+	var once sync.Once
+	// когда одна сторона закрылась, вторую тоже прерываем
+	stop := func() {
+		once.Do(func() {
+			_ = serverConn.Close()
+			_ = clientConn.SetReadDeadline(time.Now())
+		})
+	}
+	wg.Add(2)
+
+	go func() {
+		defer wg.Done()
+		defer stop()
+		p.relayFrames(session.toServer, clientConn, domain.WSFromClient, id)
+	}()
+	go func() {
+		defer wg.Done()
+		defer stop()
+		p.relayFrames(session.toClient, serverConn, domain.WSFromServer, id)
+	}()
+
+	wg.Wait()
+	log.Printf("WebSocket closed for %s (request id=%d)", req.URL.String(), id)
+}
+
+// relayFrames копирует кадры из src в dst байт в байт и сохраняет сообщения.
+// Кадр пересылается частями, какой бы он ни был длины; в историю попадает
+// не больше bodyLimit байт сообщения.
+func (p *Proxy) relayFrames(dst *lockedWriter, src io.Reader, direction string, id uint64) {
+	defer dst.close()
+
+	asm := websocket.Assembler{Limit: p.bodyLimit}
+	for {
+		frame, head, err := websocket.ReadHeader(src)
+		if err != nil {
+			logFrameError("read", direction, id, err)
+			return
+		}
+		// кадр уходит целиком, дописанные через API кадры не вклиниваются ни
+		// в него, ни между кадрами фрагментированного сообщения
+		if err = dst.forward(frame, head, src, p.bodyLimit); err != nil {
+			logFrameError("forward", direction, id, err)
+			return
+		}
+
+		if msg := asm.Push(frame); msg != nil {
+			p.saveWSMessage(id, direction, msg, false)
+		}
+	}
+}
+
+func logFrameError(op, direction string, id uint64, err error) {
+	var netErr net.Error
+	if errors.Is(err, io.EOF) || errors.Is(err, net.ErrClosed) || errors.As(err, &netErr) && netErr.Timeout() {
+		return
+	}
+	log.Printf("Failed to %s WebSocket frame from %s (request id=%d): %v", op, direction, id, err)
+}
+
+// saveWSMessage ставит сообщение в очередь записи: пересылка кадров не
+// ждёт хранилища. Если очередь заполнена, ждёт, пока в ней освободится место.
+func (p *Proxy) saveWSMessage(id uint64, direction string, msg *websocket.Message, injected bool) {
+	if id == 0 {
+		return
+	}
+
+	m := domain.WSMessage{
+		RequestID: id,
+		Direction: direction,
+		Opcode:    int(msg.Opcode),
+		Injected:  injected,
+		TS:        time.Now().UnixMilli(),
+		Size:      msg.Size,
+		Truncated: msg.Truncated,
+	}
+	m.Payload, m.Encoding = msg.Encode()
+
+	p.wsRecords <- m
+}
+
+// recordWSMessages пишет сообщения из очереди в хранилище по порядку.
+func (p *Proxy) recordWSMessages() {
+	for m := range p.wsRecords {
+		if err := p.store.SaveWSMessage(m); err != nil {
+			log.Printf("Failed to save WebSocket message for request id=%d: %v", m.RequestID, err)
+			continue
+		}
+		log.Printf("Saved WebSocket message from %s (opcode %d, %d bytes) for request id=%d", m.Direction, m.Opcode, m.Size, m.RequestID)
+	}
+}
+
+// writeSwitchingProtocols пишет клиенту ответ 101 с заголовками сервера.
+func writeSwitchingProtocols(clientConn net.Conn, resp *http.Response) error {
+	removeHopHeaders(resp.Header)
+	resp.Header.Set("Connection", "Upgrade")
+	resp.Header.Set("Upgrade", "websocket")
+
+	if _, err := fmt.Fprintf(clientConn, "HTTP/1.1 101 Switching Protocols\r\n"); err != nil {
+		return err
+	}
+	if err := resp.Header.Write(clientConn); err != nil {
+		return err
+	}
+	_, err := io.WriteString(clientConn, "\r\n")
+
+	return err
+}
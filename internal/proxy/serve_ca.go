@@ -0,0 +1,74 @@
+package proxy
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/goriiin/go-proxy/internal/ca"
+)
+
+// caHost — служебный хост: открыв http://proxy.cert/ через прокси,
+// устройство скачивает наш CA и не нуждается в ручном копировании ca.crt.
+const caHost = "proxy.cert"
+
+func isCAHost(req *http.Request) bool {
+	host := req.URL.Hostname()
+	if host == "" {
+		host = req.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+	}
+
+	return strings.EqualFold(strings.TrimSuffix(host, "."), caHost)
+}
+
+// serveCA отвечает на запрос к proxy.cert сам, не обращаясь к серверу:
+// "/" — страница со ссылками, /ca.pem, /ca.der, /ca.p12 — сертификат.
+func (p *Proxy) serveCA(req *http.Request) *http.Response {
+	if req.Body != nil {
+		_, _ = io.Copy(io.Discard, req.Body)
+	}
+
+	resp := &http.Response{
+		StatusCode: http.StatusOK,
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     http.Header{},
+		Request:    req,
+	}
+
+	var body []byte
+	switch name := path.Base(req.URL.Path); {
+	case req.URL.Path == "/" || req.URL.Path == "":
+		body = []byte(ca.IndexPage(p.caAnchor, "/"))
+		resp.Header.Set("Content-Type", "text/html; charset=utf-8")
+	case strings.HasPrefix(name, "ca."):
+		data, contentType, filename, err := ca.Export(p.caAnchor, strings.TrimPrefix(name, "ca."), req.URL.Query().Get("password"))
+		if err != nil {
+			resp.StatusCode = http.StatusNotFound
+			body = []byte(err.Error() + "\n")
+			break
+		}
+		body = data
+		resp.Header.Set("Content-Type", contentType)
+		resp.Header.Set("Content-Disposition", "attachment; filename=\""+filename+"\"")
+	default:
+		resp.StatusCode = http.StatusNotFound
+		body = []byte("not found\n")
+	}
+
+	resp.Status = strconv.Itoa(resp.StatusCode) + " " + http.StatusText(resp.StatusCode)
+	resp.ContentLength = int64(len(body))
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	log.Printf("Serving CA page %s: %s", req.URL.Path, resp.Status)
+
+	return resp
+}
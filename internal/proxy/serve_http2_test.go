@@ -0,0 +1,41 @@
+package proxy
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"testing"
+
+	"golang.org/x/net/http2"
+)
+
+// h2StreamID читает неэкспортированные поля x/net/http2: тест ловит смену их устройства.
+func TestH2StreamID(t *testing.T) {
+	sconn, cconn := net.Pipe()
+	defer cconn.Close()
+
+	ids := make(chan uint32, 3)
+	go (&http2.Server{}).ServeConn(sconn, &http2.ServeConnOpts{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ids <- h2StreamID(w)
+		}),
+	})
+
+	cc, err := (&http2.Transport{}).NewClientConn(cconn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []uint32{1, 3, 5} {
+		req, _ := http.NewRequest(http.MethodGet, "https://example.com/", nil)
+		resp, err := cc.RoundTrip(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, _ = io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+
+		if got := <-ids; got != want {
+			t.Errorf("stream id = %d, want %d", got, want)
+		}
+	}
+}
@@ -0,0 +1,303 @@
+package proxy
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/goriiin/go-proxy/internal/domain"
+	"github.com/goriiin/go-proxy/internal/intercept"
+	"github.com/goriiin/go-proxy/internal/tlsmeta"
+)
+
+// hopHeaders — заголовки одного соединения, которые нельзя пересылать дальше.
+var hopHeaders = []string{
+	"Connection",
+	"Proxy-Connection",
+	"Keep-Alive",
+	"Proxy-Authenticate",
+	"Proxy-Authorization",
+	"Te",
+	"Trailer",
+	"Transfer-Encoding",
+	"Upgrade",
+}
+
+// readRequest ждёт следующий запрос клиента не дольше idleTimeout.
+// На мусор во входном потоке отвечает 400 и возвращает ошибку.
+func (p *Proxy) readRequest(conn net.Conn, reader *bufio.Reader) (*http.Request, error) {
+	_ = conn.SetReadDeadline(time.Now().Add(p.idleTimeout))
+	req, err := http.ReadRequest(reader)
+	_ = conn.SetReadDeadline(time.Time{})
+	if err == nil {
+		return req, nil
+	}
+
+	var netErr net.Error
+	switch {
+	case errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF), errors.Is(err, net.ErrClosed):
+	case errors.As(err, &netErr) && netErr.Timeout():
+		log.Printf("Client %s idle for %v, closing", conn.RemoteAddr(), p.idleTimeout)
+	default:
+		log.Printf("Failed to read request from %s: %v", conn.RemoteAddr(), err)
+		fmt.Fprintf(conn, "HTTP/1.1 400 Bad Request\r\nConnection: close\r\n\r\n")
+	}
+
+	return nil, err
+}
+
+// serveRequest пересылает один запрос клиента на сервер, сохраняет обмен
+// и пишет ответ клиенту. Возвращает true, если соединение можно
+// использовать для следующего запроса.
+func (p *Proxy) serveRequest(clientConn net.Conn, reader *bufio.Reader, req *http.Request, f *flow) bool {
+	keepAlive := !clientWantsClose(req)
+
+	// контекст запроса из http.ReadRequest не отменяется, когда клиент
+	// уходит: за соединением следит watchClient, пока Intercept ждёт решения
+	body := newClientBody(req.Body)
+	if req.Body != nil && req.Body != http.NoBody {
+		req.Body = body
+	}
+	ctx, cancel := context.WithCancel(req.Context())
+	defer cancel()
+	req = req.WithContext(intercept.WithClientWatch(ctx, func() func() {
+		if !body.done() {
+			// соединение ещё читает транспорт
+			return func() {}
+		}
+		return watchClient(clientConn, reader, cancel)
+	}))
+
+	resp, id := p.exchange(req, f)
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusSwitchingProtocols {
+		p.relayWebSocket(newBufferedConn(clientConn, reader), req, resp, id)
+		return false
+	}
+	// тело без длины клиенту HTTP/1.0 можно отдать только до закрытия соединения
+	keepAlive = keepAlive && !resp.Close && (resp.ContentLength >= 0 || req.ProtoAtLeast(1, 1))
+
+	if err := writeResponse(clientConn, req, resp, keepAlive); err != nil {
+		log.Printf("Failed to write response back to client for %s: %v", req.URL.String(), err)
+		return false
+	}
+	log.Printf("Successfully relayed response for %s %s", req.Method, req.URL.String())
+
+	// следующий запрос начинается только после тела этого, даже если
+	// сервер или Intercept его не дочитали
+	return keepAlive && body.drain(maxDrainBody)
+}
+
+// exchange пропускает запрос через конвейер прокси (Match & Replace,
+// Intercept, сервер назначения) и возвращает ответ для клиента. Тела не
+// буферизуются: обмен сохраняется, когда вызывающий закроет тело ответа.
+// Если ответа сервера нет, возвращает ответ самого прокси с Close = true:
+// после него соединение с клиентом закрывается. На рукопожатие WebSocket
+// сервер отвечает 101, и тело такого ответа — соединение с сервером. Такой
+// обмен, как и поток text/event-stream, сохраняется сразу, и вместе с
+// ответом возвращается id записи (в остальных случаях 0).
+func (p *Proxy) exchange(req *http.Request, f *flow) (*http.Response, uint64) {
+	if isCAHost(req) {
+		return p.serveCA(req), 0
+	}
+
+	upgrade := isWebSocketUpgrade(req)
+	removeHopHeaders(req.Header)
+	if upgrade {
+		req.Header.Set("Connection", "Upgrade")
+		req.Header.Set("Upgrade", "websocket")
+		// без permessage-deflate сообщения видны и сохраняются как есть
+		req.Header.Del("Sec-WebSocket-Extensions")
+		switch req.URL.Scheme {
+		case "ws":
+			req.URL.Scheme = "http"
+		case "wss":
+			req.URL.Scheme = "https"
+		}
+	}
+	req.RequestURI = ""
+	req.Close = false
+
+	fired := p.rewrite.ApplyRequest(req)
+
+	req, err := p.intercept.Request(req)
+	if err != nil {
+		log.Printf("Request dropped by interceptor: %v", err)
+		return proxyError(req, "Dropped by proxy interceptor."), 0
+	}
+
+	inScope := p.scope.Contains(req.URL.Scheme, req.URL.Host, req.URL.Path)
+	// тело уходит на сервер по мере чтения, в историю попадает его начало
+	var reqBody *bodyCapture
+	if inScope {
+		reqBody = newBodyCapture(req.Body, p.bodyLimit)
+		if req.Body != nil && req.Body != http.NoBody {
+			req.Body = reqBody
+		}
+	}
+
+	log.Printf("Forwarding %s request to host: %s, URL: %s", req.Method, req.Host, req.URL.String())
+	resp, err := p.transport.RoundTrip(req.WithContext(f.upstreamContext(req)))
+	if err != nil {
+		log.Printf("Failed to forward request to %s: %v", req.Host, err)
+		return proxyError(req, fmt.Sprintf("Proxy failed to connect to target server: %v", err)), 0
+	}
+
+	log.Printf("Received response %s for %s %s", resp.Status, req.Method, req.URL.String())
+	upstreamTLS := tlsmeta.Upstream(resp.TLS)
+
+	switch {
+	case resp.StatusCode == http.StatusSwitchingProtocols:
+		// тело ответа 101 — поток WebSocket, правила ответа и Intercept его не трогают
+	case isStreaming(resp):
+		// поток не кончается: правила тела и Intercept ждали бы его вечно
+		log.Printf("Streaming %s response for %s, body rules and intercept skipped", resp.Header.Get("Content-Type"), req.URL.String())
+		fired = append(fired, p.rewrite.ApplyResponseHeaders(req, resp)...)
+	default:
+		fired = append(fired, p.rewrite.ApplyResponse(req, resp)...)
+
+		edited, err := p.intercept.Response(req, resp)
+		if err != nil {
+			resp.Body.Close()
+			log.Printf("Response dropped by interceptor: %v", err)
+			return proxyError(req, "Dropped by proxy interceptor."), 0
+		}
+		resp = edited
+	}
+	if len(fired) > 0 {
+		log.Printf("Rewrite rules fired for %s: %v", req.URL.String(), fired)
+	}
+
+	if !inScope {
+		log.Printf("Out of scope, not recording %s", req.URL.String())
+		return resp, 0
+	}
+
+	meta := f.meta()
+	meta.Rules = fired
+	meta.Proto = req.Proto
+	if upstreamTLS != nil {
+		if meta.TLS == nil {
+			meta.TLS = &domain.TLSInfo{}
+		}
+		meta.TLS.Upstream = upstreamTLS
+	}
+	save := func(respBody *bodyCapture) uint64 {
+		parsed := parseHTTPRequest(req, reqBody)
+		parsed.ServerName = f.upstreamServerName(req)
+		id, err := p.store.Save(parsed, parseHTTPResponse(resp, respBody), meta)
+		if err != nil {
+			log.Printf("Failed to save request for %s: %v", req.Host, err)
+			return 0
+		}
+		log.Printf("Saved request with id=%d", id)
+
+		return id
+	}
+
+	// id рукопожатия нужен сообщениям WebSocket, поэтому 101 сохраняется сразу
+	if resp.StatusCode == http.StatusSwitchingProtocols {
+		return resp, save(nil)
+	}
+
+	// то же с потоком событий: запись видна, пока он идёт, события
+	// сохраняются по одному; тело целиком в записи не хранится
+	if isEventStream(resp) {
+		id := save(nil)
+		if id != 0 {
+			resp.Body = p.newSSETap(resp.Body, id)
+		}
+		return resp, id
+	}
+
+	// остальное — когда тело ответа дочитано клиентом и закрыто
+	respBody := newBodyCapture(resp.Body, p.bodyLimit)
+	respBody.onClose = func() { save(respBody) }
+	resp.Body = respBody
+
+	return resp, 0
+}
+
+// proxyError — ответ 502 от самого прокси, после которого соединение закрывается.
+func proxyError(req *http.Request, text string) *http.Response {
+	body := text + "\r\n"
+
+	return &http.Response{
+		Status:        "502 Bad Gateway",
+		StatusCode:    http.StatusBadGateway,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{"Content-Type": {"text/plain"}},
+		Body:          io.NopCloser(strings.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Close:         true,
+		Request:       req,
+	}
+}
+
+// clientWantsClose учитывает и Connection, и нестандартный Proxy-Connection,
+// который шлют браузеры и curl.
+func clientWantsClose(req *http.Request) bool {
+	if hasToken(req.Header.Get("Connection"), "close") || hasToken(req.Header.Get("Proxy-Connection"), "close") {
+		return true
+	}
+	if hasToken(req.Header.Get("Proxy-Connection"), "keep-alive") {
+		return false
+	}
+
+	return req.Close
+}
+
+// writeResponse отдаёт ответ клиенту по HTTP/1.1, заменяя заголовки
+// соединения сервера на свои. Тело копируется по мере поступления; если
+// его длина заранее неизвестна, клиенту HTTP/1.1 оно идёт чанками.
+func writeResponse(clientConn net.Conn, req *http.Request, resp *http.Response, keepAlive bool) error {
+	removeHopHeaders(resp.Header)
+	resp.Proto, resp.ProtoMajor, resp.ProtoMinor = "HTTP/1.1", 1, 1
+	resp.Close = !keepAlive
+	if keepAlive && !req.ProtoAtLeast(1, 1) {
+		resp.Header.Set("Connection", "keep-alive")
+	}
+	resp.TransferEncoding = nil
+	if resp.ContentLength < 0 && req.ProtoAtLeast(1, 1) && req.Method != http.MethodHead && bodyAllowed(resp.StatusCode) {
+		resp.TransferEncoding = []string{"chunked"}
+	}
+
+	return resp.Write(clientConn)
+}
+
+// bodyAllowed — у ответа с таким кодом может быть тело (RFC 9110, 6.4.1).
+func bodyAllowed(status int) bool {
+	return status >= 200 && status != http.StatusNoContent && status != http.StatusNotModified
+}
+
+func removeHopHeaders(h http.Header) {
+	for _, f := range h.Values("Connection") {
+		for _, name := range strings.Split(f, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				h.Del(name)
+			}
+		}
+	}
+	for _, name := range hopHeaders {
+		h.Del(name)
+	}
+}
+
+func hasToken(v, token string) bool {
+	for _, t := range strings.Split(v, ",") {
+		if strings.EqualFold(strings.TrimSpace(t), token) {
+			return true
+		}
+	}
+
+	return false
+}
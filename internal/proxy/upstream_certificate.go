@@ -0,0 +1,40 @@
+package proxy
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"time"
+)
+
+const upstreamCertTimeout = 5 * time.Second
+
+// upstreamCertificate подключается к targetHost с SNI serverName и
+// возвращает его сертификат. Проверка цепочки не нужна: из сертификата
+// берутся только имена и реквизиты для поддельного.
+func (p *Proxy) upstreamCertificate(targetHost, serverName string) (*x509.Certificate, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), upstreamCertTimeout)
+	defer cancel()
+
+	conn, err := p.transport.Dial(ctx, targetHost)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	// настройки TLS хоста нужны ради клиентского сертификата при mTLS
+	cfg := p.transport.TLSConfig(serverName)
+	cfg.InsecureSkipVerify = true
+	tlsConn := tls.Client(conn, cfg)
+	if err = tlsConn.HandshakeContext(ctx); err != nil {
+		return nil, err
+	}
+
+	certs := tlsConn.ConnectionState().PeerCertificates
+	if len(certs) == 0 {
+		return nil, errors.New("server sent no certificate")
+	}
+
+	return certs[0], nil
+}
@@ -0,0 +1,34 @@
+package proxy
+
+import (
+	"bufio"
+	"log"
+	"net"
+	"sync/atomic"
+	"time"
+)
+
+// watchClient следит, не закрыл ли клиент соединение, пока прокси занят его
+// запросом (например, ждёт решения Intercept), и тогда вызывает gone.
+// Возвращает функцию остановки; после неё reader снова можно читать —
+// пришедшие тем временем байты следующего запроса остаются в буфере.
+// Тело запроса к этому моменту должно быть дочитано.
+func watchClient(conn net.Conn, reader *bufio.Reader, gone func()) (stop func()) {
+	var stopped atomic.Bool
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if _, err := reader.Peek(1); err != nil && !stopped.Load() {
+			log.Printf("Client %s disconnected while its request was pending: %v", conn.RemoteAddr(), err)
+			gone()
+		}
+	}()
+
+	return func() {
+		stopped.Store(true)
+		// прерываем Peek и ждём, пока горутина отпустит reader
+		_ = conn.SetReadDeadline(time.Now())
+		<-done
+		_ = conn.SetReadDeadline(time.Time{})
+	}
+}
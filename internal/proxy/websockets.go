@@ -0,0 +1,177 @@
+package proxy
+
+import (
+	"errors"
+	"io"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/goriiin/go-proxy/internal/domain"
+	"github.com/goriiin/go-proxy/internal/websocket"
+)
+
+// ErrNoSession — соединение WebSocket уже закрыто или не записывалось.
+var ErrNoSession = errors.New("no open WebSocket with this id")
+
+// ErrFragmented — по этому направлению дольше injectWait идёт
+// фрагментированное сообщение, и дописать своё между его кадрами нельзя.
+var ErrFragmented = errors.New("a fragmented message is still in progress")
+
+// injectWait — сколько дописанное сообщение ждёт конца чужого фрагментированного.
+const injectWait = 10 * time.Second
+
+// WSSession — открытое через прокси соединение WebSocket.
+type WSSession struct {
+	ID     uint64    `json:"id"` // id записи рукопожатия
+	URL    string    `json:"url"`
+	Opened time.Time `json:"opened"`
+
+	toServer *lockedWriter
+	toClient *lockedWriter
+}
+
+// WebSockets — реестр открытых соединений WebSocket, в которые можно
+// дописывать свои сообщения через API.
+type WebSockets struct {
+	mu       sync.Mutex
+	sessions map[uint64]*WSSession
+	save     func(id uint64, direction string, msg *websocket.Message, injected bool)
+}
+
+func (w *WebSockets) add(s *WSSession) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.sessions[s.ID] = s
+}
+
+func (w *WebSockets) remove(id uint64) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	delete(w.sessions, id)
+}
+
+// List возвращает открытые соединения, старые первыми.
+func (w *WebSockets) List() []WSSession {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	out := make([]WSSession, 0, len(w.sessions))
+	for _, s := range w.sessions {
+		out = append(out, WSSession{ID: s.ID, URL: s.URL, Opened: s.Opened})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ID < out[j].ID })
+
+	return out
+}
+
+// Send дописывает сообщение в открытое соединение id: direction "client" —
+// от имени клиента на сервер, "server" — от имени сервера клиенту.
+// Сообщение сохраняется с пометкой injected, ответы записываются как обычно.
+func (w *WebSockets) Send(id uint64, direction string, opcode byte, payload []byte) error {
+	w.mu.Lock()
+	s := w.sessions[id]
+	w.mu.Unlock()
+	if s == nil {
+		return ErrNoSession
+	}
+
+	frame := &websocket.Frame{Fin: true, Opcode: opcode, Payload: payload}
+	var dst *lockedWriter
+	switch direction {
+	case domain.WSFromClient:
+		// клиент обязан маскировать кадры
+		frame.Masked = true
+		dst = s.toServer
+	case domain.WSFromServer:
+		dst = s.toClient
+	default:
+		return errors.New(`direction must be "client" or "server"`)
+	}
+
+	if err := dst.inject(frame); err != nil {
+		return err
+	}
+	w.save(id, direction, &websocket.Message{Opcode: opcode, Payload: payload}, true)
+
+	return nil
+}
+
+// lockedWriter не даёт перемешаться пересылаемым и дописанным кадрам.
+// Пока по направлению идёт фрагментированное сообщение, дописанный кадр
+// данных ждёт его последнего кадра (RFC 6455, 5.4); управляющие кадры
+// между фрагментами допустимы и уходят сразу.
+type lockedWriter struct {
+	mu         sync.Mutex
+	idle       *sync.Cond // сигнал о конце сообщения или закрытии
+	w          io.Writer
+	fragmented bool
+	closed     bool
+}
+
+func newLockedWriter(w io.Writer) *lockedWriter {
+	l := &lockedWriter{w: w}
+	l.idle = sync.NewCond(&l.mu)
+
+	return l
+}
+
+// forward пересылает кадр из src целиком: заголовок head и тело, от
+// которого в f.Payload остаётся не больше keep байт.
+func (l *lockedWriter) forward(f *websocket.Frame, head []byte, src io.Reader, keep int) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	_, err := l.w.Write(head)
+	if err == nil {
+		err = websocket.CopyPayload(l.w, src, f, keep)
+	}
+	if !f.IsControl() {
+		l.fragmented = !f.Fin
+		if f.Fin {
+			l.idle.Broadcast()
+		}
+	}
+
+	return err
+}
+
+// inject пишет дописанный через API кадр.
+func (l *lockedWriter) inject(f *websocket.Frame) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if !f.IsControl() && l.fragmented && !l.closed {
+		timer := time.AfterFunc(injectWait, func() {
+			l.mu.Lock()
+			defer l.mu.Unlock()
+			l.idle.Broadcast()
+		})
+		defer timer.Stop()
+
+		deadline := time.Now().Add(injectWait)
+		for l.fragmented && !l.closed && time.Now().Before(deadline) {
+			l.idle.Wait()
+		}
+		if l.fragmented && !l.closed {
+			return ErrFragmented
+		}
+	}
+	if l.closed {
+		return ErrNoSession
+	}
+
+	return websocket.WriteFrame(l.w, f)
+}
+
+// close отмечает, что пересылка по направлению закончилась: ждущие
+// дописанные кадры получают ErrNoSession.
+func (l *lockedWriter) close() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.closed = true
+	l.idle.Broadcast()
+}
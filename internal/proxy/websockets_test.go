@@ -0,0 +1,99 @@
+package proxy
+
+import (
+	"bytes"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/goriiin/go-proxy/internal/websocket"
+)
+
+// Дописанное сообщение не попадает между кадрами фрагментированного,
+// а управляющий кадр — попадает.
+func TestInjectWaitsForFragmentedMessage(t *testing.T) {
+	var out bytes.Buffer
+	l := newLockedWriter(&out)
+
+	forward := func(f *websocket.Frame) {
+		t.Helper()
+		var src bytes.Buffer
+		if err := websocket.WriteFrame(&src, f); err != nil {
+			t.Fatal(err)
+		}
+		hf, head, err := websocket.ReadHeader(&src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := l.forward(hf, head, &src, 1024); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	forward(&websocket.Frame{Opcode: websocket.OpText, Payload: []byte("Hel")})
+
+	injected := make(chan error, 1)
+	go func() {
+		injected <- l.inject(&websocket.Frame{Fin: true, Opcode: websocket.OpText, Payload: []byte("injected")})
+	}()
+	if err := l.inject(&websocket.Frame{Fin: true, Opcode: websocket.OpPing, Payload: []byte("p")}); err != nil {
+		t.Fatal(err)
+	}
+	forward(&websocket.Frame{Fin: true, Opcode: websocket.OpPong})
+
+	select {
+	case err := <-injected:
+		t.Fatalf("injected during a fragmented message: %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	forward(&websocket.Frame{Fin: true, Opcode: websocket.OpContinuation, Payload: []byte("lo")})
+	if err := <-injected; err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	for out.Len() > 0 {
+		f, _, err := websocket.ReadFrame(&out)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, string(f.Payload))
+	}
+	want := []string{"Hel", "p", "", "lo", "injected"}
+	if len(got) != len(want) {
+		t.Fatalf("frames = %q, want %q", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("frames = %q, want %q", got, want)
+		}
+	}
+}
+
+// Когда пересылка закончилась посреди сообщения, ждущий кадр не висит.
+func TestInjectAfterClose(t *testing.T) {
+	l := newLockedWriter(&bytes.Buffer{})
+	var src bytes.Buffer
+	_ = websocket.WriteFrame(&src, &websocket.Frame{Opcode: websocket.OpBinary, Payload: []byte{1}})
+	f, head, _ := websocket.ReadHeader(&src)
+	if err := l.forward(f, head, &src, 1024); err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	var err error
+	go func() {
+		defer wg.Done()
+		err = l.inject(&websocket.Frame{Fin: true, Opcode: websocket.OpBinary})
+	}()
+	time.Sleep(20 * time.Millisecond)
+	l.close()
+	wg.Wait()
+
+	if !errors.Is(err, ErrNoSession) {
+		t.Errorf("err = %v, want %v", err, ErrNoSession)
+	}
+}
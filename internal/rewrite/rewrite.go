@@ -0,0 +1,359 @@
+package rewrite
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"path"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/google/uuid"
+
+	"github.com/goriiin/go-proxy/internal/domain"
+)
+
+const (
+	PhaseRequest  = "request"
+	PhaseResponse = "response"
+
+	HeaderSet     = "header_set"
+	HeaderRemove  = "header_remove"
+	HeaderReplace = "header_replace"
+	BodyReplace   = "body_replace"
+	BodyRegex     = "body_regex"
+	CookieSet     = "cookie_set"
+)
+
+// RuleStore — хранилище правил, чтобы они переживали перезапуск.
+type RuleStore interface {
+	SaveRewriteRule(domain.RewriteRule) error
+	DeleteRewriteRule(id string) error
+	RewriteRules() ([]domain.RewriteRule, error)
+}
+
+type rule struct {
+	domain.RewriteRule
+	re *regexp.Regexp
+}
+
+// Engine применяет правила Match & Replace к запросам и ответам.
+// Нулевой *Engine ничего не меняет.
+type Engine struct {
+	store RuleStore
+
+	mu    sync.RWMutex
+	rules []*rule
+}
+
+// New загружает сохранённые правила из rs.
+func New(rs RuleStore) (*Engine, error) {
+	e := &Engine{store: rs}
+
+	saved, err := rs.RewriteRules()
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range saved {
+		compiled, err := compile(r)
+		if err != nil {
+			return nil, fmt.Errorf("rule %s: %w", r.ID, err)
+		}
+		e.rules = append(e.rules, compiled)
+	}
+
+	return e, nil
+}
+
+// Rules возвращает правила в порядке применения.
+func (e *Engine) Rules() []domain.RewriteRule {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	out := make([]domain.RewriteRule, len(e.rules))
+	for i, r := range e.rules {
+		out[i] = r.RewriteRule
+	}
+
+	return out
+}
+
+// Put добавляет правило (без ID) или заменяет существующее и сохраняет его.
+func (e *Engine) Put(r domain.RewriteRule) (domain.RewriteRule, error) {
+	if r.ID == "" {
+		r.ID = uuid.NewString()
+	}
+	compiled, err := compile(r)
+	if err != nil {
+		return domain.RewriteRule{}, err
+	}
+	if err = e.store.SaveRewriteRule(r); err != nil {
+		return domain.RewriteRule{}, err
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for i, old := range e.rules {
+		if old.ID == r.ID {
+			e.rules[i] = compiled
+			return r, nil
+		}
+	}
+	e.rules = append(e.rules, compiled)
+
+	return r, nil
+}
+
+// Delete удаляет правило по ID.
+func (e *Engine) Delete(id string) (bool, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	for i, r := range e.rules {
+		if r.ID == id {
+			if err := e.store.DeleteRewriteRule(id); err != nil {
+				return false, err
+			}
+			e.rules = append(e.rules[:i], e.rules[i+1:]...)
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+func compile(r domain.RewriteRule) (*rule, error) {
+	switch r.Phase {
+	case PhaseRequest, PhaseResponse:
+	default:
+		return nil, fmt.Errorf("unknown phase %q", r.Phase)
+	}
+	if _, err := path.Match(r.Host, ""); err != nil {
+		return nil, fmt.Errorf("bad host pattern %q: %w", r.Host, err)
+	}
+
+	c := &rule{RewriteRule: r}
+	switch r.Type {
+	case HeaderSet, HeaderRemove, CookieSet:
+		if r.Key == "" {
+			return nil, fmt.Errorf("%s needs key", r.Type)
+		}
+	case HeaderReplace, BodyRegex:
+		if r.Type == HeaderReplace && r.Key == "" {
+			return nil, fmt.Errorf("%s needs key", r.Type)
+		}
+		re, err := regexp.Compile(r.Match)
+		if err != nil {
+			return nil, fmt.Errorf("bad match regexp %q: %w", r.Match, err)
+		}
+		c.re = re
+	case BodyReplace:
+		if r.Match == "" {
+			return nil, fmt.Errorf("%s needs match", r.Type)
+		}
+	default:
+		return nil, fmt.Errorf("unknown rule type %q", r.Type)
+	}
+
+	return c, nil
+}
+
+// ApplyRequest меняет запрос и возвращает ID сработавших правил.
+func (e *Engine) ApplyRequest(req *http.Request) []string {
+	rules := e.matching(req, PhaseRequest)
+	if len(rules) == 0 {
+		return nil
+	}
+
+	var fired []string
+	for _, r := range rules {
+		if r.applyHeaders(req.Header, PhaseRequest) {
+			fired = append(fired, r.ID)
+		}
+	}
+
+	if hasBodyRules(rules) {
+		body, _ := io.ReadAll(req.Body)
+		_ = req.Body.Close()
+		body, bodyFired := applyBody(rules, body)
+		fired = append(fired, bodyFired...)
+
+		req.Body = io.NopCloser(bytes.NewReader(body))
+		req.ContentLength = int64(len(body))
+		req.Header.Del("Content-Length")
+		if len(body) == 0 {
+			req.Body = http.NoBody
+		}
+	}
+
+	return fired
+}
+
+// ApplyResponse меняет ответ на req и возвращает ID сработавших правил.
+// Тело в gzip распаковывается перед заменой и отдаётся клиенту без сжатия.
+func (e *Engine) ApplyResponse(req *http.Request, resp *http.Response) []string {
+	rules := e.matching(req, PhaseResponse)
+	if len(rules) == 0 {
+		return nil
+	}
+
+	var fired []string
+	for _, r := range rules {
+		if r.applyHeaders(resp.Header, PhaseResponse) {
+			fired = append(fired, r.ID)
+		}
+	}
+
+	if hasBodyRules(rules) {
+		body, _ := io.ReadAll(resp.Body)
+		_ = resp.Body.Close()
+		if strings.EqualFold(resp.Header.Get("Content-Encoding"), "gzip") {
+			if gr, err := gzip.NewReader(bytes.NewReader(body)); err == nil {
+				if decoded, err := io.ReadAll(gr); err == nil {
+					body = decoded
+					resp.Header.Del("Content-Encoding")
+				}
+			}
+		}
+		body, bodyFired := applyBody(rules, body)
+		fired = append(fired, bodyFired...)
+
+		resp.Body = io.NopCloser(bytes.NewReader(body))
+		resp.ContentLength = int64(len(body))
+		resp.TransferEncoding = nil
+		resp.Header.Del("Content-Length")
+	}
+
+	return fired
+}
+
+// ApplyResponseHeaders применяет к ответу только правила заголовков. Нужен
+// для потоковых ответов (SSE и т. п.): их тело не кончается, и правила
+// тела ждали бы его вечно.
+func (e *Engine) ApplyResponseHeaders(req *http.Request, resp *http.Response) []string {
+	var fired []string
+	for _, r := range e.matching(req, PhaseResponse) {
+		if r.applyHeaders(resp.Header, PhaseResponse) {
+			fired = append(fired, r.ID)
+		}
+	}
+
+	return fired
+}
+
+func (e *Engine) matching(req *http.Request, phase string) []*rule {
+	if e == nil {
+		return nil
+	}
+
+	host := req.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.ToLower(host)
+
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	var out []*rule
+	for _, r := range e.rules {
+		if !r.Enabled || r.Phase != phase {
+			continue
+		}
+		if r.Host != "" {
+			if ok, _ := path.Match(strings.ToLower(r.Host), host); !ok {
+				continue
+			}
+		}
+		out = append(out, r)
+	}
+
+	return out
+}
+
+func (r *rule) applyHeaders(h http.Header, phase string) bool {
+	switch r.Type {
+	case HeaderSet:
+		h.Set(r.Key, r.Replace)
+		return true
+	case HeaderRemove:
+		if _, ok := h[http.CanonicalHeaderKey(r.Key)]; !ok {
+			return false
+		}
+		h.Del(r.Key)
+		return true
+	case HeaderReplace:
+		values := h.Values(r.Key)
+		changed := false
+		for i, v := range values {
+			if nv := r.re.ReplaceAllString(v, r.Replace); nv != v {
+				values[i] = nv
+				changed = true
+			}
+		}
+		return changed
+	case CookieSet:
+		c := &http.Cookie{Name: r.Key, Value: r.Replace}
+		if phase == PhaseResponse {
+			c.Path = "/"
+			h.Add("Set-Cookie", c.String())
+			return true
+		}
+		h.Set("Cookie", setCookie(h.Get("Cookie"), c))
+		return true
+	}
+
+	return false
+}
+
+// setCookie заменяет или добавляет cookie в значении заголовка Cookie.
+func setCookie(header string, c *http.Cookie) string {
+	var parts []string
+	for _, p := range strings.Split(header, ";") {
+		p = strings.TrimSpace(p)
+		if p == "" {
+			continue
+		}
+		if name, _, _ := strings.Cut(p, "="); name == c.Name {
+			continue
+		}
+		parts = append(parts, p)
+	}
+
+	return strings.Join(append(parts, c.String()), "; ")
+}
+
+func hasBodyRules(rules []*rule) bool {
+	for _, r := range rules {
+		if r.Type == BodyReplace || r.Type == BodyRegex {
+			return true
+		}
+	}
+
+	return false
+}
+
+func applyBody(rules []*rule, body []byte) ([]byte, []string) {
+	var fired []string
+	for _, r := range rules {
+		var out []byte
+		switch r.Type {
+		case BodyReplace:
+			out = bytes.ReplaceAll(body, []byte(r.Match), []byte(r.Replace))
+		case BodyRegex:
+			out = r.re.ReplaceAll(body, []byte(r.Replace))
+		default:
+			continue
+		}
+		if !bytes.Equal(out, body) {
+			fired = append(fired, r.ID)
+			body = out
+		}
+	}
+
+	return body, fired
+}
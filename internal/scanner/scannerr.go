@@ -2,19 +2,39 @@ package scanner
 
 import (
 	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
 	"net/http"
 	"os"
 	"strings"
 
+	"github.com/goriiin/go-proxy/internal/domain"
+	"github.com/goriiin/go-proxy/internal/scope"
 	"github.com/goriiin/go-proxy/internal/store"
+	"github.com/goriiin/go-proxy/internal/upstream"
 )
 
+// ErrOutOfScope — цель запроса вне scope, сканер её не трогает.
+var ErrOutOfScope = errors.New("target is out of scope")
+
+// ErrTruncated — тело запроса сохранено не целиком (обрезано по лимиту или
+// оборвалось), повторить его нельзя.
+var ErrTruncated = errors.New("stored request body is truncated")
+
 type Scanner struct {
-	s     *store.Store
-	words []string
+	s         *store.Store
+	words     []string
+	transport http.RoundTripper
+	scope     *scope.Scope
 }
 
-func New(s *store.Store, wordlist string) (*Scanner, error) {
+// New создаёт сканер; transport — общий с прокси пул соединений,
+// sp ограничивает цели повторов и перебора (nil — без ограничений).
+func New(s *store.Store, wordlist string, transport http.RoundTripper, sp *scope.Scope) (*Scanner, error) {
 	fd, err := os.Open(wordlist)
 	if err != nil {
 		return nil, err
@@ -25,30 +45,131 @@ func New(s *store.Store, wordlist string) (*Scanner, error) {
 	for sc.Scan() {
 		w = append(w, strings.TrimSpace(sc.Text()))
 	}
-	return &Scanner{s: s, words: w}, nil
+	return &Scanner{s: s, words: w, transport: transport, scope: sp}, nil
 }
 
-func (sc *Scanner) Repeat(id uint64) (*http.Response, error) {
-	item, _ := sc.s.Get(id)
-	reqMap := item["data"].(map[string]interface{})["request"].(map[string]interface{})
-	raw := reqMap["raw_request"].(string)
+func (sc *Scanner) Repeat(id uint64) (*domain.ParsedResponse, error) {
+	item, err := sc.s.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	reqMap, err := storedRequest(id, item)
+	if err != nil {
+		return nil, err
+	}
+	raw, _ := reqMap["raw_request"].(string)
+	scheme, _ := reqMap["scheme"].(string)
+	truncated, _ := reqMap["body_truncated"].(bool)
+	incomplete, _ := reqMap["body_incomplete"].(bool)
+	if truncated || incomplete {
+		return nil, ErrTruncated
+	}
+
+	req := parseRaw(raw, scheme)
+	if req == nil {
+		return nil, fmt.Errorf("cannot parse stored request %d", id)
+	}
+	// повтор идёт туда же, куда прокси отправил исходный запрос (исходный
+	// адрес назначения, IP из CONNECT), а не на хост из заголовка Host
+	if target, _ := reqMap["target"].(string); target != "" {
+		req.URL.Host = target
+	}
+	if name, _ := reqMap["server_name"].(string); name != "" {
+		req = req.WithContext(upstream.WithServerName(req.Context(), name))
+	}
+	if !sc.scope.Contains(req.URL.Scheme, req.URL.Host, req.URL.Path) {
+		return nil, ErrOutOfScope
+	}
+	// тело отправляется байт в байт из body: в raw_request двоичного тела нет,
+	// а у запроса чанками в нём нет и длины. У старых записей body — строка,
+	// и тело берётся из raw_request как раньше.
+	if body, ok := reqMap["body"].([]byte); ok {
+		setBody(req, body)
+	}
+
+	resp, err := sc.transport.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	hdrs := map[string]string{}
+	for k, v := range resp.Header {
+		hdrs[k] = strings.Join(v, ", ")
+	}
+
+	sum := sha256.Sum256(body)
+
+	return &domain.ParsedResponse{
+		Code:        resp.StatusCode,
+		Message:     resp.Status,
+		Headers:     hdrs,
+		Body:        body,
+		BodyBinary:  domain.IsBinary(body, false),
+		ContentType: resp.Header.Get("Content-Type"),
+		BodySize:    int64(len(body)),
+		BodySHA256:  hex.EncodeToString(sum[:]),
+	}, nil
+}
 
-	resp, err := http.DefaultTransport.RoundTrip(parseRaw(raw))
-	return resp, err
+func setBody(req *http.Request, body []byte) {
+	req.ContentLength = int64(len(body))
+	req.TransferEncoding = nil
+	req.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(body)), nil
+	}
+	req.Body, _ = req.GetBody()
+	if len(body) == 0 {
+		req.Body, req.GetBody = http.NoBody, nil
+	}
 }
 
 func (sc *Scanner) DirBuster(id uint64) ([]map[string]interface{}, error) {
-	item, _ := sc.s.Get(id)
-	reqMap := item["data"].(map[string]interface{})["request"].(map[string]interface{})
-	host := item["host"].(string)
-	origPath := reqMap["path"].(string)
+	item, err := sc.s.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	reqMap, err := storedRequest(id, item)
+	if err != nil {
+		return nil, err
+	}
+	host, _ := item["host"].(string)
+	method, _ := reqMap["method"].(string)
+	if host == "" || method == "" {
+		return nil, fmt.Errorf("stored request %d has no host or method", id)
+	}
+	origPath, _ := reqMap["path"].(string)
+	scheme, _ := reqMap["scheme"].(string)
+	if scheme == "" {
+		scheme = "http"
+	}
+	if !sc.scope.ContainsHost(scheme, host) {
+		return nil, ErrOutOfScope
+	}
 
 	var findings []map[string]interface{}
 	for _, w := range sc.words {
 		p := "/" + strings.TrimLeft(w, "/")
-		req, _ := http.NewRequest(reqMap["method"].(string), "http://"+host+p, nil)
-		resp, err := http.DefaultTransport.RoundTrip(req)
-		if err == nil && resp.StatusCode != http.StatusNotFound {
+		if !sc.scope.Contains(scheme, host, p) {
+			continue
+		}
+		req, err := http.NewRequest(method, scheme+"://"+host+p, nil)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := sc.transport.RoundTrip(req)
+		if err != nil {
+			continue
+		}
+		// дочитываем тело, чтобы соединение вернулось в пул
+		_, _ = io.Copy(io.Discard, resp.Body)
+		_ = resp.Body.Close()
+		if resp.StatusCode != http.StatusNotFound {
 			findings = append(findings, map[string]interface{}{
 				"path":      p,
 				"status":    resp.StatusCode,
@@ -59,12 +180,26 @@ func (sc *Scanner) DirBuster(id uint64) ([]map[string]interface{}, error) {
 	return findings, nil
 }
 
-func parseRaw(raw string) *http.Request {
+// storedRequest достаёт запрос из записи хранилища.
+func storedRequest(id uint64, item map[string]interface{}) (map[string]interface{}, error) {
+	data, _ := item["data"].(map[string]interface{})
+	reqMap, ok := data["request"].(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("stored record %d has no request", id)
+	}
+
+	return reqMap, nil
+}
+
+func parseRaw(raw, scheme string) *http.Request {
 	req, err := http.ReadRequest(bufio.NewReader(strings.NewReader(raw)))
 	if err != nil {
 		return nil // лучше обработать ошибку наверху — тут кратко
 	}
 
+	if req.URL.Scheme == "" {
+		req.URL.Scheme = scheme
+	}
 	if req.URL.Scheme == "" {
 		req.URL.Scheme = "http"
 	}
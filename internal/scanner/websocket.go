@@ -0,0 +1,246 @@
+package scanner
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/goriiin/go-proxy/internal/domain"
+	"github.com/goriiin/go-proxy/internal/websocket"
+)
+
+// FuzzMarker в тексте сообщения заменяется каждым значением из WSSend.Fuzz.
+const FuzzMarker = "{{FUZZ}}"
+
+const defaultWSWait = 2 * time.Second
+
+// WSSend — сообщение для отправки в повторное соединение: своё содержимое
+// или сохранённое сообщение с номером Replay, при необходимости изменённое.
+type WSSend struct {
+	// Replay — номер сообщения в списке /requests/{id}/ws; nil — только Payload.
+	Replay *int `json:"replay,omitempty"`
+	// Opcode — 1 (текст) по умолчанию или тип сохранённого сообщения.
+	Opcode int `json:"opcode,omitempty"`
+	// Payload заменяет данные сохранённого сообщения, если не пуст.
+	Payload  string `json:"payload,omitempty"`
+	Encoding string `json:"encoding,omitempty"` // base64 — Payload закодирован
+	// Fuzz — по сообщению на каждое значение, подставленное вместо FuzzMarker.
+	Fuzz []string `json:"fuzz,omitempty"`
+}
+
+// WSRepeat — что отправить и сколько ждать ответов после последнего сообщения.
+type WSRepeat struct {
+	Messages []WSSend `json:"messages"`
+	WaitMS   int      `json:"wait_ms,omitempty"`
+}
+
+// WSRepeatResult — новая запись рукопожатия и весь обмен сообщениями.
+type WSRepeatResult struct {
+	ID       uint64             `json:"id"`
+	Status   string             `json:"status"`
+	Messages []domain.WSMessage `json:"messages"`
+}
+
+// RepeatWS заново открывает WebSocket по сохранённому рукопожатию id через
+// общий транспорт (с теми же настройками TLS и вышестоящим прокси),
+// отправляет сообщения и записывает ответы. Обмен сохраняется новой
+// записью с meta.repeat_of = id.
+func (sc *Scanner) RepeatWS(id uint64, r WSRepeat) (*WSRepeatResult, error) {
+	item, err := sc.s.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	data, _ := item["data"].(map[string]interface{})
+	reqMap, _ := data["request"].(map[string]interface{})
+	raw, _ := reqMap["raw_request"].(string)
+	scheme, _ := reqMap["scheme"].(string)
+
+	frames, err := sc.wsFrames(id, r.Messages)
+	if err != nil {
+		return nil, err
+	}
+
+	req := parseRaw(raw, scheme)
+	if req == nil {
+		return nil, fmt.Errorf("cannot parse stored request %d", id)
+	}
+	if !strings.EqualFold(req.Header.Get("Upgrade"), "websocket") {
+		return nil, fmt.Errorf("request %d is not a WebSocket handshake", id)
+	}
+	if !sc.scope.Contains(req.URL.Scheme, req.URL.Host, req.URL.Path) {
+		return nil, ErrOutOfScope
+	}
+
+	resp, err := sc.transport.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	hdrs := map[string]string{}
+	for k, v := range resp.Header {
+		hdrs[k] = strings.Join(v, ", ")
+	}
+	parsedResp := domain.ParsedResponse{Code: resp.StatusCode, Message: resp.Status, Headers: hdrs}
+	res := &WSRepeatResult{Status: resp.Status, Messages: []domain.WSMessage{}}
+
+	newID, err := sc.s.Save(wsParsedRequest(req, raw, scheme), parsedResp, domain.Meta{Proto: req.Proto, RepeatOf: id})
+	if err != nil {
+		return nil, err
+	}
+	res.ID = newID
+	log.Printf("Repeating WebSocket %d as %d: %s", id, newID, resp.Status)
+
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		return res, nil
+	}
+	conn, ok := resp.Body.(io.ReadWriteCloser)
+	if !ok {
+		return nil, errors.New("upstream connection cannot be used for WebSocket")
+	}
+
+	var mu sync.Mutex
+	record := func(direction string, msg *websocket.Message) {
+		m := domain.WSMessage{
+			RequestID: newID,
+			Direction: direction,
+			Opcode:    int(msg.Opcode),
+			TS:        time.Now().UnixMilli(),
+		}
+		m.Payload, m.Encoding = msg.Encode()
+		if err := sc.s.SaveWSMessage(m); err != nil {
+			log.Printf("Failed to save WebSocket message for request id=%d: %v", newID, err)
+		}
+
+		mu.Lock()
+		res.Messages = append(res.Messages, m)
+		mu.Unlock()
+	}
+
+	// ответы читаем, пока сервер не закроет соединение или не выйдет время
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		var asm websocket.Assembler
+		for {
+			frame, _, err := websocket.ReadFrame(conn)
+			if err != nil {
+				return
+			}
+			if msg := asm.Push(frame); msg != nil {
+				record(domain.WSFromServer, msg)
+				if msg.Opcode == websocket.OpClose {
+					return
+				}
+			}
+		}
+	}()
+
+	for _, f := range frames {
+		if err = websocket.WriteFrame(conn, f); err != nil {
+			log.Printf("Failed to send WebSocket message to %s: %v", req.URL.String(), err)
+			break
+		}
+		record(domain.WSFromClient, &websocket.Message{Opcode: f.Opcode, Payload: f.Payload})
+	}
+
+	wait := defaultWSWait
+	if r.WaitMS > 0 {
+		wait = time.Duration(r.WaitMS) * time.Millisecond
+	}
+	select {
+	case <-done:
+	case <-time.After(wait):
+		_ = websocket.WriteFrame(conn, &websocket.Frame{Fin: true, Opcode: websocket.OpClose, Masked: true, Payload: []byte{0x03, 0xe8}})
+	}
+	_ = conn.Close()
+	<-done
+
+	return res, nil
+}
+
+// wsFrames превращает запрошенные сообщения в кадры клиента.
+func (sc *Scanner) wsFrames(id uint64, sends []WSSend) ([]*websocket.Frame, error) {
+	var stored []domain.WSMessage
+	var frames []*websocket.Frame
+	for i, s := range sends {
+		opcode := s.Opcode
+		var payload []byte
+		if s.Replay != nil {
+			if stored == nil {
+				var err error
+				if stored, err = sc.s.WSMessages(id); err != nil {
+					return nil, err
+				}
+			}
+			if *s.Replay < 0 || *s.Replay >= len(stored) {
+				return nil, fmt.Errorf("message %d: no stored message %d", i, *s.Replay)
+			}
+			m := stored[*s.Replay]
+			p, err := websocket.Decode(m.Payload, m.Encoding)
+			if err != nil {
+				return nil, fmt.Errorf("message %d: %w", i, err)
+			}
+			payload = p
+			if opcode == 0 {
+				opcode = m.Opcode
+			}
+		}
+		if s.Payload != "" {
+			p, err := websocket.Decode(s.Payload, s.Encoding)
+			if err != nil {
+				return nil, fmt.Errorf("message %d: %w", i, err)
+			}
+			payload = p
+		}
+		if opcode == 0 {
+			opcode = websocket.OpText
+		}
+
+		payloads := [][]byte{payload}
+		if len(s.Fuzz) > 0 {
+			payloads = payloads[:0]
+			for _, v := range s.Fuzz {
+				payloads = append(payloads, []byte(strings.ReplaceAll(string(payload), FuzzMarker, v)))
+			}
+		}
+		for _, p := range payloads {
+			frames = append(frames, &websocket.Frame{Fin: true, Opcode: byte(opcode), Masked: true, Payload: p})
+		}
+	}
+
+	return frames, nil
+}
+
+// wsParsedRequest — запись повторного рукопожатия для истории.
+func wsParsedRequest(req *http.Request, raw, scheme string) domain.ParsedRequest {
+	hdrs := map[string]string{}
+	for k, v := range req.Header {
+		hdrs[k] = strings.Join(v, ", ")
+	}
+	query := map[string]interface{}{}
+	for k, v := range req.URL.Query() {
+		query[k] = strings.Join(v, ", ")
+	}
+	cookies := map[string]string{}
+	for _, c := range req.Cookies() {
+		cookies[c.Name] = c.Value
+	}
+
+	return domain.ParsedRequest{
+		Method:     req.Method,
+		Path:       req.URL.Path,
+		GetParams:  query,
+		PostParams: map[string]interface{}{},
+		Headers:    hdrs,
+		Cookies:    cookies,
+		Host:       req.Host,
+		Scheme:     scheme,
+		RawRequest: raw,
+	}
+}
@@ -0,0 +1,232 @@
+package scope
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	// OutOfScopeRecordless — туннели вне scope расшифровываются, но обмены не записываются.
+	OutOfScopeRecordless = "mitm"
+	// OutOfScopeTunnel — туннели вне scope пропускаются как есть, без подмены сертификата.
+	OutOfScopeTunnel = "tunnel"
+)
+
+// Rule — условие на цель; пустое поле подходит под любое значение.
+type Rule struct {
+	Host   string `json:"host"`   // glob, например *.example.com
+	Port   int    `json:"port"`   // 0 — любой порт
+	Path   string `json:"path"`   // регулярное выражение для пути
+	Scheme string `json:"scheme"` // http или https
+
+	pathRe *regexp.Regexp
+}
+
+// Config — описание scope. Пустой Include означает «всё, кроме Exclude».
+type Config struct {
+	Include    []Rule `json:"include"`
+	Exclude    []Rule `json:"exclude"`
+	OutOfScope string `json:"out_of_scope"`
+}
+
+// Scope решает, какие обмены записывать и какие туннели расшифровывать.
+// Нулевой *Scope включает в scope всё.
+type Scope struct {
+	file string
+
+	mu  sync.RWMutex
+	cfg Config
+}
+
+// Load читает scope из JSON-файла. Пустое имя или отсутствующий файл
+// дают пустой scope; изменения через Set сохраняются в тот же файл.
+func Load(file string) (*Scope, error) {
+	s := &Scope{file: file, cfg: Config{OutOfScope: OutOfScopeRecordless}}
+	if file == "" {
+		return s, nil
+	}
+
+	data, err := os.ReadFile(file)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var cfg Config
+	if err = json.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", file, err)
+	}
+	if err = compile(&cfg); err != nil {
+		return nil, err
+	}
+	s.cfg = cfg
+
+	return s, nil
+}
+
+// Config возвращает текущие настройки.
+func (s *Scope) Config() Config {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.cfg
+}
+
+// Set заменяет настройки и, если scope загружен из файла, перезаписывает его.
+func (s *Scope) Set(cfg Config) error {
+	if err := compile(&cfg); err != nil {
+		return err
+	}
+	if s.file != "" {
+		data, err := json.MarshalIndent(cfg, "", "  ")
+		if err != nil {
+			return err
+		}
+		if err = os.WriteFile(s.file, data, 0o644); err != nil {
+			return err
+		}
+	}
+
+	s.mu.Lock()
+	s.cfg = cfg
+	s.mu.Unlock()
+
+	return nil
+}
+
+func compile(cfg *Config) error {
+	switch cfg.OutOfScope {
+	case "":
+		cfg.OutOfScope = OutOfScopeRecordless
+	case OutOfScopeRecordless, OutOfScopeTunnel:
+	default:
+		return fmt.Errorf("unknown out_of_scope action %q", cfg.OutOfScope)
+	}
+
+	for _, rules := range [][]Rule{cfg.Include, cfg.Exclude} {
+		for i := range rules {
+			r := &rules[i]
+			if _, err := path.Match(r.Host, ""); err != nil {
+				return fmt.Errorf("bad host pattern %q: %w", r.Host, err)
+			}
+			if r.Path != "" {
+				re, err := regexp.Compile(r.Path)
+				if err != nil {
+					return fmt.Errorf("bad path regexp %q: %w", r.Path, err)
+				}
+				r.pathRe = re
+			}
+		}
+	}
+
+	return nil
+}
+
+// Contains сообщает, входит ли запрос scheme://hostport/path в scope.
+// Порт в hostport можно опустить — тогда берётся порт схемы по умолчанию.
+func (s *Scope) Contains(scheme, hostport, urlPath string) bool {
+	if s == nil {
+		return true
+	}
+	host, port := splitHostPort(scheme, hostport)
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, r := range s.cfg.Exclude {
+		if r.matchTarget(scheme, host, port) && r.matchPath(urlPath) {
+			return false
+		}
+	}
+	if len(s.cfg.Include) == 0 {
+		return true
+	}
+	for _, r := range s.cfg.Include {
+		if r.matchTarget(scheme, host, port) && r.matchPath(urlPath) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ContainsHost — проверка для туннеля, когда путь ещё неизвестен: цель
+// в scope, если в него может попасть хоть один её запрос.
+func (s *Scope) ContainsHost(scheme, hostport string) bool {
+	if s == nil {
+		return true
+	}
+	host, port := splitHostPort(scheme, hostport)
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, r := range s.cfg.Exclude {
+		// исключение по пути не исключает весь хост
+		if r.pathRe == nil && r.matchTarget(scheme, host, port) {
+			return false
+		}
+	}
+	if len(s.cfg.Include) == 0 {
+		return true
+	}
+	for _, r := range s.cfg.Include {
+		if r.matchTarget(scheme, host, port) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Tunnel сообщает, что соединение с hostport нужно пропустить без
+// расшифровки, потому что цель вне scope.
+func (s *Scope) Tunnel(scheme, hostport string) bool {
+	if s == nil || s.Config().OutOfScope != OutOfScopeTunnel {
+		return false
+	}
+
+	return !s.ContainsHost(scheme, hostport)
+}
+
+func (r *Rule) matchTarget(scheme, host string, port int) bool {
+	if r.Scheme != "" && !strings.EqualFold(r.Scheme, scheme) {
+		return false
+	}
+	if r.Port != 0 && r.Port != port {
+		return false
+	}
+	if r.Host != "" {
+		if ok, _ := path.Match(strings.ToLower(r.Host), host); !ok {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (r *Rule) matchPath(urlPath string) bool {
+	return r.pathRe == nil || r.pathRe.MatchString(urlPath)
+}
+
+var defaultPorts = map[string]int{"http": 80, "https": 443}
+
+func splitHostPort(scheme, hostport string) (string, int) {
+	host, portStr, err := net.SplitHostPort(hostport)
+	if err != nil {
+		return strings.ToLower(strings.Trim(hostport, "[]")), defaultPorts[strings.ToLower(scheme)]
+	}
+	port, _ := strconv.Atoi(portStr)
+
+	return strings.ToLower(host), port
+}
@@ -0,0 +1,126 @@
+// Package sse разбирает поток Server-Sent Events (text/event-stream) по
+// правилам HTML Living Standard, чтобы прокси мог сохранять события по
+// одному, не задерживая сам поток.
+package sse
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+)
+
+// ContentType — тип содержимого потока событий.
+const ContentType = "text/event-stream"
+
+// maxPending — предел недочитанной строки; всё сверх него отбрасывается,
+// чтобы поток без переводов строк не копился в памяти.
+const maxPending = 1 << 20
+
+// Event — одно событие потока.
+type Event struct {
+	ID    string
+	Event string // пусто — "message"
+	Data  string
+	Retry int // поле retry, мс; 0 — не задано
+}
+
+// Parser собирает события из произвольно нарезанных кусков потока.
+type Parser struct {
+	line    []byte
+	started bool // BOM в начале потока уже проверен
+	skipLF  bool // предыдущий кусок закончился на \r
+
+	id    string
+	event string
+	data  strings.Builder
+	retry int
+}
+
+// Push добавляет кусок потока и возвращает события, завершённые в нём.
+func (p *Parser) Push(b []byte) []Event {
+	if !p.started && len(p.line)+len(b) < 3 && bytes.HasPrefix([]byte("\xef\xbb\xbf"), append(p.line, b...)) {
+		// начало BOM ещё не пришло целиком
+		p.line = append(p.line, b...)
+		return nil
+	}
+	if !p.started {
+		b = bytes.TrimPrefix(append(p.line, b...), []byte("\xef\xbb\xbf"))
+		p.line, p.started = nil, true
+	}
+
+	var out []Event
+	for len(b) > 0 {
+		if p.skipLF {
+			p.skipLF = false
+			if b[0] == '\n' {
+				b = b[1:]
+				continue
+			}
+		}
+
+		i := bytes.IndexAny(b, "\r\n")
+		if i < 0 {
+			if len(p.line) < maxPending {
+				p.line = append(p.line, b[:min(len(b), maxPending-len(p.line))]...)
+			}
+			break
+		}
+		p.line = append(p.line, b[:i]...)
+		p.skipLF = b[i] == '\r'
+		b = b[i+1:]
+
+		if ev, ok := p.processLine(p.line); ok {
+			out = append(out, ev)
+		}
+		p.line = p.line[:0]
+	}
+
+	return out
+}
+
+// processLine применяет одну строку; пустая строка завершает событие.
+func (p *Parser) processLine(line []byte) (Event, bool) {
+	if len(line) == 0 {
+		return p.dispatch()
+	}
+	if line[0] == ':' {
+		return Event{}, false // комментарий
+	}
+
+	field, value := string(line), ""
+	if i := bytes.IndexByte(line, ':'); i >= 0 {
+		field, value = string(line[:i]), strings.TrimPrefix(string(line[i+1:]), " ")
+	}
+
+	switch field {
+	case "event":
+		p.event = value
+	case "data":
+		p.data.WriteString(value)
+		p.data.WriteByte('\n')
+	case "id":
+		if !strings.ContainsRune(value, 0) {
+			p.id = value
+		}
+	case "retry":
+		if n, err := strconv.Atoi(value); err == nil && n >= 0 && strings.Trim(value, "0123456789") == "" {
+			p.retry = n
+		}
+	}
+
+	return Event{}, false
+}
+
+// dispatch отдаёт накопленное событие. id сохраняется между событиями,
+// как last event ID у браузера; событие без data не отдаётся.
+func (p *Parser) dispatch() (Event, bool) {
+	data, event, retry := p.data.String(), p.event, p.retry
+	p.data.Reset()
+	p.event, p.retry = "", 0
+
+	if data == "" {
+		return Event{}, false
+	}
+
+	return Event{ID: p.id, Event: event, Data: strings.TrimSuffix(data, "\n"), Retry: retry}, true
+}
@@ -0,0 +1,119 @@
+package sse
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParser(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want []Event
+	}{
+		{
+			name: "single event",
+			in:   "data: hello\n\n",
+			want: []Event{{Data: "hello"}},
+		},
+		{
+			name: "all fields",
+			in:   "id: 7\nevent: update\nretry: 3000\ndata: x\n\n",
+			want: []Event{{ID: "7", Event: "update", Data: "x", Retry: 3000}},
+		},
+		{
+			name: "multiline data",
+			in:   "data: a\ndata: b\ndata\n\n",
+			want: []Event{{Data: "a\nb\n"}},
+		},
+		{
+			// пробел после двоеточия снимается только один
+			name: "leading spaces",
+			in:   "data:no space\n\ndata:  two\n\n",
+			want: []Event{{Data: "no space"}, {Data: " two"}},
+		},
+		{
+			name: "crlf and cr",
+			in:   "data: a\r\n\r\ndata: b\r\rdata: c\n\n",
+			want: []Event{{Data: "a"}, {Data: "b"}, {Data: "c"}},
+		},
+		{
+			name: "comments and unknown fields",
+			in:   ": keep-alive\nfoo: bar\ndata: x\n\n: ping\n\n",
+			want: []Event{{Data: "x"}},
+		},
+		{
+			// id остаётся до следующего id, event и retry — только для своего события
+			name: "id persists, event resets",
+			in:   "id: 1\nevent: e\ndata: a\n\ndata: b\n\nid\ndata: c\n\n",
+			want: []Event{{ID: "1", Event: "e", Data: "a"}, {ID: "1", Data: "b"}, {Data: "c"}},
+		},
+		{
+			name: "id with NUL ignored",
+			in:   "id: 1\ndata: a\n\nid: 2\x003\ndata: b\n\n",
+			want: []Event{{ID: "1", Data: "a"}, {ID: "1", Data: "b"}},
+		},
+		{
+			name: "bad retry ignored",
+			in:   "retry: 10s\ndata: a\n\nretry: -1\ndata: b\n\n",
+			want: []Event{{Data: "a"}, {Data: "b"}},
+		},
+		{
+			name: "event without data not dispatched",
+			in:   "event: empty\n\nid: 5\n\ndata: x\n\n",
+			want: []Event{{ID: "5", Data: "x"}},
+		},
+		{
+			name: "bom",
+			in:   "\xef\xbb\xbfdata: a\n\n",
+			want: []Event{{Data: "a"}},
+		},
+		{
+			name: "unterminated event",
+			in:   "data: a\n\ndata: b\n",
+			want: []Event{{Data: "a"}},
+		},
+	}
+
+	for _, tt := range tests {
+		// тот же поток целиком, по байту и кусками по 3 байта
+		for _, size := range []int{len(tt.in), 1, 3} {
+			t.Run(fmt.Sprintf("%s/chunk %d", tt.name, size), func(t *testing.T) {
+				var p Parser
+				var got []Event
+				for in := tt.in; len(in) > 0; {
+					n := min(size, len(in))
+					got = append(got, p.Push([]byte(in[:n]))...)
+					in = in[n:]
+				}
+
+				if !reflect.DeepEqual(got, tt.want) {
+					t.Errorf("got %+v, want %+v", got, tt.want)
+				}
+			})
+		}
+	}
+}
+
+// Строка длиннее maxPending обрезается, а разбор продолжается.
+func TestParserLongLine(t *testing.T) {
+	var p Parser
+	long := strings.Repeat("x", maxPending+100)
+	p.Push([]byte("data: "))
+	for i := 0; i < len(long); i += 4096 {
+		p.Push([]byte(long[i:min(i+4096, len(long))]))
+	}
+	got := p.Push([]byte("\n\ndata: next\n\n"))
+
+	if len(got) != 2 {
+		t.Fatalf("got %d events, want 2", len(got))
+	}
+	if want := maxPending - len("data: "); len(got[0].Data) != want {
+		t.Errorf("long event data = %d bytes, want %d", len(got[0].Data), want)
+	}
+	if got[1].Data != "next" {
+		t.Errorf("next event data = %q", got[1].Data)
+	}
+}
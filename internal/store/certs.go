@@ -0,0 +1,62 @@
+package store
+
+import (
+	"time"
+
+	tarantool "github.com/tarantool/go-tarantool/v2"
+)
+
+type certTuple struct {
+	_msgpack struct{} `msgpack:",as_array"`
+
+	Host string
+	PEM  string
+	TS   uint64
+}
+
+// LoadCert возвращает сохранённый сертификат с ключом в PEM или nil.
+func (s *Store) LoadCert(host string) ([]byte, error) {
+	var rows []certTuple
+	err := s.conn.Do(
+		tarantool.NewSelectRequest("certs").
+			Index("primary").
+			Iterator(tarantool.IterEq).
+			Key([]interface{}{host}).
+			Limit(1),
+	).GetTyped(&rows)
+	if err != nil || len(rows) == 0 {
+		return nil, err
+	}
+	return []byte(rows[0].PEM), nil
+}
+
+func (s *Store) SaveCert(host string, data []byte) error {
+	_, err := s.conn.Do(
+		tarantool.NewReplaceRequest("certs").
+			Tuple([]interface{}{host, string(data), uint64(time.Now().Unix())}),
+	).Get()
+	return err
+}
+
+// ClearCerts удаляет все сохранённые сертификаты.
+func (s *Store) ClearCerts() error {
+	var rows []certTuple
+	err := s.conn.Do(
+		tarantool.NewSelectRequest("certs").
+			Iterator(tarantool.IterAll),
+	).GetTyped(&rows)
+	if err != nil {
+		return err
+	}
+	for _, row := range rows {
+		_, err = s.conn.Do(
+			tarantool.NewDeleteRequest("certs").
+				Index("primary").
+				Key([]interface{}{row.Host}),
+		).Get()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
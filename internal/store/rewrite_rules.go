@@ -0,0 +1,47 @@
+package store
+
+import (
+	"github.com/goriiin/go-proxy/internal/domain"
+
+	tarantool "github.com/tarantool/go-tarantool/v2"
+)
+
+type rewriteRuleTuple struct {
+	_msgpack struct{} `msgpack:",as_array"`
+
+	ID   string
+	Rule domain.RewriteRule
+}
+
+func (s *Store) SaveRewriteRule(r domain.RewriteRule) error {
+	_, err := s.conn.Do(
+		tarantool.NewReplaceRequest("rewrite_rules").Tuple([]interface{}{r.ID, r}),
+	).Get()
+	return err
+}
+
+func (s *Store) DeleteRewriteRule(id string) error {
+	_, err := s.conn.Do(
+		tarantool.NewDeleteRequest("rewrite_rules").
+			Index("primary").
+			Key([]interface{}{id}),
+	).Get()
+	return err
+}
+
+func (s *Store) RewriteRules() ([]domain.RewriteRule, error) {
+	var rows []rewriteRuleTuple
+	err := s.conn.Do(
+		tarantool.NewSelectRequest("rewrite_rules").
+			Iterator(tarantool.IterAll),
+	).GetTyped(&rows)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]domain.RewriteRule, len(rows))
+	for i, row := range rows {
+		out[i] = row.Rule
+	}
+	return out, nil
+}
@@ -0,0 +1,42 @@
+package store
+
+import (
+	"github.com/goriiin/go-proxy/internal/domain"
+
+	tarantool "github.com/tarantool/go-tarantool/v2"
+)
+
+type sseEventTuple struct {
+	_msgpack struct{} `msgpack:",as_array"`
+
+	ID        uint64
+	RequestID uint64
+	Event     domain.SSEEvent
+}
+
+func (s *Store) SaveSSEEvent(e domain.SSEEvent) error {
+	_, err := s.conn.Do(
+		tarantool.NewInsertRequest("sse_events").Tuple([]interface{}{nil, e.RequestID, e}),
+	).Get()
+	return err
+}
+
+// SSEEvents возвращает события ответа в порядке их прихода.
+func (s *Store) SSEEvents(requestID uint64) ([]domain.SSEEvent, error) {
+	var rows []sseEventTuple
+	err := s.conn.Do(
+		tarantool.NewSelectRequest("sse_events").
+			Index("request").
+			Iterator(tarantool.IterEq).
+			Key([]interface{}{requestID}),
+	).GetTyped(&rows)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]domain.SSEEvent, len(rows))
+	for i, row := range rows {
+		out[i] = row.Event
+	}
+	return out, nil
+}
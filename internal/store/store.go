@@ -2,6 +2,7 @@ package store
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"github.com/goriiin/go-proxy/internal/domain"
 	"time"
@@ -11,6 +12,9 @@ import (
 
 type Store struct{ conn *tarantool.Connection }
 
+// ErrNotFound — записи с таким id нет.
+var ErrNotFound = errors.New("not found")
+
 func New(addr string) (*Store, error) {
 	dialer := tarantool.NetDialer{
 		Address: addr,
@@ -25,13 +29,13 @@ func New(addr string) (*Store, error) {
 	return &Store{conn: conn}, nil
 }
 
-func (s *Store) Save(req domain.ParsedRequest, resp domain.ParsedResponse) (uint64, error) {
+func (s *Store) Save(req domain.ParsedRequest, resp domain.ParsedResponse, meta domain.Meta) (uint64, error) {
 	tuple := []interface{}{
 		nil, // auto‑inc id (sequence)
 		req.Host,
 		req.Method,
 		req.Path,
-		map[string]interface{}{"request": req, "response": resp},
+		map[string]interface{}{"request": req, "response": resp, "meta": meta},
 		uint64(time.Now().Unix()),
 	}
 
@@ -43,8 +47,15 @@ func (s *Store) Save(req domain.ParsedRequest, resp domain.ParsedResponse) (uint
 		return 0, err
 	}
 
-	id := data[0].(uint64)
-	return id, nil
+	if len(data) == 0 {
+		return 0, fmt.Errorf("insert returned no tuple")
+	}
+	tuple, ok := data[0].([]interface{})
+	if !ok || len(tuple) == 0 {
+		return 0, fmt.Errorf("unexpected insert result: %v", data[0])
+	}
+
+	return toUint64(tuple[0]), nil
 }
 
 func (s *Store) Get(id uint64) (map[string]interface{}, error) {
@@ -60,9 +71,9 @@ func (s *Store) Get(id uint64) (map[string]interface{}, error) {
 	}
 	rows := data
 	if len(rows) == 0 {
-		return nil, fmt.Errorf("not found")
+		return nil, ErrNotFound
 	}
-	return rows[0].(map[string]interface{}), nil
+	return tupleToMap(rows[0]), nil
 }
 
 func (s *Store) List() ([]map[string]interface{}, error) {
@@ -76,7 +87,91 @@ func (s *Store) List() ([]map[string]interface{}, error) {
 	arr := raw
 	out := make([]map[string]interface{}, len(arr))
 	for i, v := range arr {
-		out[i] = v.(map[string]interface{})
+		out[i] = tupleToMap(v)
 	}
 	return out, nil
 }
+
+// requestFields — порядок полей space requests (см. tarantool/init.lua).
+var requestFields = []string{"id", "host", "method", "path", "data", "ts"}
+
+// tupleToMap превращает кортеж из Tarantool в map с именами полей,
+// чтобы API и сканер работали с ним как с JSON‑объектом.
+func tupleToMap(v interface{}) map[string]interface{} {
+	tuple, _ := v.([]interface{})
+	out := make(map[string]interface{}, len(requestFields))
+	for i, name := range requestFields {
+		if i < len(tuple) {
+			out[name] = normalize(tuple[i])
+		}
+	}
+	return out
+}
+
+// normalize приводит вложенные map[interface{}]interface{} из msgpack
+// к map[string]interface{}, а целые — к uint64/int64.
+func normalize(v interface{}) interface{} {
+	switch x := v.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(x))
+		for k, vv := range x {
+			m[fmt.Sprint(k)] = normalize(vv)
+		}
+		return m
+	case map[string]interface{}:
+		for k, vv := range x {
+			x[k] = normalize(vv)
+		}
+		return x
+	case []interface{}:
+		for i, vv := range x {
+			x[i] = normalize(vv)
+		}
+		return x
+	case int8, int16, int32, int:
+		return toInt64(x)
+	case uint8, uint16, uint32, uint:
+		return toUint64(x)
+	}
+	return v
+}
+
+func toUint64(v interface{}) uint64 {
+	switch x := v.(type) {
+	case uint64:
+		return x
+	case uint32:
+		return uint64(x)
+	case uint16:
+		return uint64(x)
+	case uint8:
+		return uint64(x)
+	case uint:
+		return uint64(x)
+	case int64:
+		return uint64(x)
+	case int32:
+		return uint64(x)
+	case int16:
+		return uint64(x)
+	case int8:
+		return uint64(x)
+	case int:
+		return uint64(x)
+	}
+	return 0
+}
+
+func toInt64(v interface{}) int64 {
+	switch x := v.(type) {
+	case int8:
+		return int64(x)
+	case int16:
+		return int64(x)
+	case int32:
+		return int64(x)
+	case int:
+		return int64(x)
+	}
+	return int64(toUint64(v))
+}
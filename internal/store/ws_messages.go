@@ -0,0 +1,42 @@
+package store
+
+import (
+	"github.com/goriiin/go-proxy/internal/domain"
+
+	tarantool "github.com/tarantool/go-tarantool/v2"
+)
+
+type wsMessageTuple struct {
+	_msgpack struct{} `msgpack:",as_array"`
+
+	ID        uint64
+	RequestID uint64
+	Message   domain.WSMessage
+}
+
+func (s *Store) SaveWSMessage(m domain.WSMessage) error {
+	_, err := s.conn.Do(
+		tarantool.NewInsertRequest("ws_messages").Tuple([]interface{}{nil, m.RequestID, m}),
+	).Get()
+	return err
+}
+
+// WSMessages возвращает сообщения соединения в порядке их записи.
+func (s *Store) WSMessages(requestID uint64) ([]domain.WSMessage, error) {
+	var rows []wsMessageTuple
+	err := s.conn.Do(
+		tarantool.NewSelectRequest("ws_messages").
+			Index("request").
+			Iterator(tarantool.IterEq).
+			Key([]interface{}{requestID}),
+	).GetTyped(&rows)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]domain.WSMessage, len(rows))
+	for i, row := range rows {
+		out[i] = row.Message
+	}
+	return out, nil
+}
@@ -0,0 +1,325 @@
+package tlsmeta
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Расширения ClientHello, которые нужны для отпечатков.
+const (
+	extServerName        = 0x0000
+	extSupportedGroups   = 0x000a
+	extPointFormats      = 0x000b
+	extSignatureAlgs     = 0x000d
+	extALPN              = 0x0010
+	extSupportedVersions = 0x002b
+)
+
+// ClientHello — поля ClientHello в порядке, в котором их прислал клиент.
+type ClientHello struct {
+	Version           uint16 // legacy_version
+	CipherSuites      []uint16
+	Extensions        []uint16
+	SupportedGroups   []uint16
+	PointFormats      []uint8
+	SignatureAlgs     []uint16
+	ALPN              []string
+	SupportedVersions []uint16
+	ServerName        string
+}
+
+var errShort = errors.New("truncated client hello")
+
+// ParseClientHello разбирает ClientHello из начала потока TLS-записей клиента.
+func ParseClientHello(raw []byte) (*ClientHello, error) {
+	// сообщение может быть разбито на несколько записей — склеиваем их
+	var msg []byte
+	for len(raw) >= 5 {
+		if raw[0] != 0x16 {
+			return nil, fmt.Errorf("unexpected TLS record type %d", raw[0])
+		}
+		n := int(binary.BigEndian.Uint16(raw[3:5]))
+		if len(raw) < 5+n {
+			break
+		}
+		msg = append(msg, raw[5:5+n]...)
+		raw = raw[5+n:]
+		if len(msg) >= 4 && len(msg) >= 4+int(msg[1])<<16|int(msg[2])<<8|int(msg[3]) {
+			break
+		}
+	}
+	if len(msg) < 4 || msg[0] != 1 {
+		return nil, errors.New("not a client hello")
+	}
+	n := int(msg[1])<<16 | int(msg[2])<<8 | int(msg[3])
+	if len(msg) < 4+n {
+		return nil, errShort
+	}
+
+	r := reader(msg[4 : 4+n])
+	h := &ClientHello{}
+	var ok bool
+	if h.Version, ok = r.u16(); !ok {
+		return nil, errShort
+	}
+	if _, ok = r.bytes(32); !ok {
+		return nil, errShort
+	}
+	if _, ok = r.vec8(); !ok { // session_id
+		return nil, errShort
+	}
+	ciphers, ok := r.vec16()
+	if !ok {
+		return nil, errShort
+	}
+	h.CipherSuites = ciphers.u16s()
+	if _, ok = r.vec8(); !ok { // compression_methods
+		return nil, errShort
+	}
+	if len(r) == 0 {
+		return h, nil
+	}
+
+	exts, ok := r.vec16()
+	if !ok {
+		return nil, errShort
+	}
+	for len(exts) > 0 {
+		typ, ok1 := exts.u16()
+		data, ok2 := exts.vec16()
+		if !ok1 || !ok2 {
+			return nil, errShort
+		}
+		h.Extensions = append(h.Extensions, typ)
+
+		switch typ {
+		case extServerName:
+			list, _ := data.vec16()
+			for len(list) > 0 {
+				nameType, _ := list.bytes(1)
+				name, ok := list.vec16()
+				if !ok {
+					break
+				}
+				if len(nameType) == 1 && nameType[0] == 0 {
+					h.ServerName = string(name)
+				}
+			}
+		case extSupportedGroups:
+			list, _ := data.vec16()
+			h.SupportedGroups = list.u16s()
+		case extPointFormats:
+			list, _ := data.vec8()
+			h.PointFormats = list
+		case extSignatureAlgs:
+			list, _ := data.vec16()
+			h.SignatureAlgs = list.u16s()
+		case extALPN:
+			list, _ := data.vec16()
+			for len(list) > 0 {
+				proto, ok := list.vec8()
+				if !ok {
+					break
+				}
+				h.ALPN = append(h.ALPN, string(proto))
+			}
+		case extSupportedVersions:
+			list, _ := data.vec8()
+			h.SupportedVersions = reader(list).u16s()
+		}
+	}
+
+	return h, nil
+}
+
+// JA3 — строка отпечатка JA3 и её MD5.
+func (h *ClientHello) JA3() (string, string) {
+	points := make([]uint16, len(h.PointFormats))
+	for i, p := range h.PointFormats {
+		points[i] = uint16(p)
+	}
+	s := strings.Join([]string{
+		strconv.Itoa(int(h.Version)),
+		joinDec(h.CipherSuites),
+		joinDec(h.Extensions),
+		joinDec(h.SupportedGroups),
+		joinDec(points),
+	}, ",")
+	sum := md5.Sum([]byte(s))
+
+	return s, hex.EncodeToString(sum[:])
+}
+
+// JA4 — отпечаток JA4 (TCP) вида t13d1516h2_8daaf6152771_e5627efa2ab1.
+func (h *ClientHello) JA4() string {
+	version := h.Version
+	if supported := noGrease(h.SupportedVersions); len(supported) > 0 {
+		version = slices.Max(supported)
+	}
+	sni := "i"
+	if h.ServerName != "" {
+		sni = "d"
+	}
+	alpn := "00"
+	if len(h.ALPN) > 0 && h.ALPN[0] != "" {
+		first := h.ALPN[0]
+		if isAlnum(first[0]) && isAlnum(first[len(first)-1]) {
+			alpn = string([]byte{first[0], first[len(first)-1]})
+		} else {
+			hx := hex.EncodeToString([]byte(first))
+			alpn = string([]byte{hx[0], hx[len(hx)-1]})
+		}
+	}
+
+	ciphers := noGrease(h.CipherSuites)
+	exts := noGrease(h.Extensions)
+	a := fmt.Sprintf("t%s%s%02d%02d%s", ja4Version(version), sni, min(len(ciphers), 99), min(len(exts), 99), alpn)
+
+	b := "000000000000"
+	if len(ciphers) > 0 {
+		b = hash12(joinHex(sorted(ciphers)))
+	}
+
+	var rest []uint16
+	for _, e := range exts {
+		if e != extServerName && e != extALPN {
+			rest = append(rest, e)
+		}
+	}
+	c := "000000000000"
+	if len(rest) > 0 {
+		in := joinHex(sorted(rest))
+		if sig := noGrease(h.SignatureAlgs); len(sig) > 0 {
+			in += "_" + joinHex(sig)
+		}
+		c = hash12(in)
+	}
+
+	return a + "_" + b + "_" + c
+}
+
+func ja4Version(v uint16) string {
+	switch v {
+	case 0x0304:
+		return "13"
+	case 0x0303:
+		return "12"
+	case 0x0302:
+		return "11"
+	case 0x0301:
+		return "10"
+	case 0x0300:
+		return "s3"
+	}
+
+	return "00"
+}
+
+// isGrease — значения GREASE (RFC 8701), которые отпечатки не учитывают.
+func isGrease(v uint16) bool {
+	return v&0x0f0f == 0x0a0a && v>>8 == v&0xff
+}
+
+func noGrease(in []uint16) []uint16 {
+	out := make([]uint16, 0, len(in))
+	for _, v := range in {
+		if !isGrease(v) {
+			out = append(out, v)
+		}
+	}
+
+	return out
+}
+
+func sorted(in []uint16) []uint16 {
+	out := append([]uint16(nil), in...)
+	sort.Slice(out, func(i, j int) bool { return out[i] < out[j] })
+
+	return out
+}
+
+func joinDec(in []uint16) string {
+	parts := make([]string, 0, len(in))
+	for _, v := range noGrease(in) {
+		parts = append(parts, strconv.Itoa(int(v)))
+	}
+
+	return strings.Join(parts, "-")
+}
+
+func joinHex(in []uint16) string {
+	parts := make([]string, len(in))
+	for i, v := range in {
+		parts[i] = fmt.Sprintf("%04x", v)
+	}
+
+	return strings.Join(parts, ",")
+}
+
+func hash12(s string) string {
+	sum := sha256.Sum256([]byte(s))
+
+	return hex.EncodeToString(sum[:])[:12]
+}
+
+func isAlnum(c byte) bool {
+	return c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+// reader — срез с методами чтения полей TLS, сдвигающими его начало.
+type reader []byte
+
+func (r *reader) bytes(n int) ([]byte, bool) {
+	if len(*r) < n {
+		return nil, false
+	}
+	b := (*r)[:n]
+	*r = (*r)[n:]
+
+	return b, true
+}
+
+func (r *reader) u16() (uint16, bool) {
+	b, ok := r.bytes(2)
+	if !ok {
+		return 0, false
+	}
+
+	return binary.BigEndian.Uint16(b), true
+}
+
+func (r *reader) vec8() (reader, bool) {
+	n, ok := r.bytes(1)
+	if !ok {
+		return nil, false
+	}
+
+	return r.bytes(int(n[0]))
+}
+
+func (r *reader) vec16() (reader, bool) {
+	n, ok := r.u16()
+	if !ok {
+		return nil, false
+	}
+
+	return r.bytes(int(n))
+}
+
+func (r reader) u16s() []uint16 {
+	out := make([]uint16, 0, len(r)/2)
+	for len(r) >= 2 {
+		v, _ := r.u16()
+		out = append(out, v)
+	}
+
+	return out
+}
@@ -0,0 +1,223 @@
+package tlsmeta
+
+import (
+	"crypto/tls"
+	"io"
+	"net"
+	"slices"
+	"testing"
+)
+
+// chromeHello — ClientHello из примера в описании JA4 (FoxIO): 15 шифров,
+// 16 расширений, h2. GREASE вставлен в каждый список, расширения идут не по
+// порядку, как у настоящего клиента.
+func chromeHello() *ClientHello {
+	return &ClientHello{
+		Version: 0x0303,
+		CipherSuites: []uint16{
+			0x1a1a, 0x1301, 0x1302, 0x1303, 0xc02b, 0xc02f, 0xc02c, 0xc030,
+			0xcca9, 0xcca8, 0xc013, 0xc014, 0x009c, 0x009d, 0x002f, 0x0035,
+		},
+		Extensions: []uint16{
+			0x2a2a, 0x0000, 0x0017, 0xff01, 0x000a, 0x000b, 0x0023, 0x0010,
+			0x0005, 0x000d, 0x0012, 0x0033, 0x002d, 0x002b, 0x001b, 0x4469, 0x0015, 0x3a3a,
+		},
+		SupportedGroups:   []uint16{0x4a4a, 0x001d, 0x0017, 0x0018},
+		PointFormats:      []uint8{0},
+		SignatureAlgs:     []uint16{0x0403, 0x0804, 0x0401, 0x0503, 0x0805, 0x0501, 0x0806, 0x0601},
+		ALPN:              []string{"h2", "http/1.1"},
+		SupportedVersions: []uint16{0x5a5a, 0x0304, 0x0303},
+		ServerName:        "example.com",
+	}
+}
+
+func TestJA4(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(h *ClientHello)
+		want   string
+	}{
+		{
+			name: "reference",
+			want: "t13d1516h2_8daaf6152771_e5627efa2ab1",
+		},
+		{
+			// хеши считаются по отсортированным шифрам и расширениям
+			name: "cipher and extension order",
+			modify: func(h *ClientHello) {
+				slices.Reverse(h.CipherSuites)
+				slices.Reverse(h.Extensions)
+			},
+			want: "t13d1516h2_8daaf6152771_e5627efa2ab1",
+		},
+		{
+			// а подписи — в исходном порядке
+			name: "signature order matters",
+			modify: func(h *ClientHello) {
+				slices.Reverse(h.SignatureAlgs)
+			},
+			want: "t13d1516h2_8daaf6152771_" + hash12("0005,000a,000b,000d,0012,0015,0017,001b,0023,002b,002d,0033,4469,ff01_0601,0806,0501,0805,0503,0401,0804,0403"),
+		},
+		{
+			name:   "alpn first and last character",
+			modify: func(h *ClientHello) { h.ALPN = []string{"http/1.1", "h2"} },
+			want:   "t13d1516h1_8daaf6152771_e5627efa2ab1",
+		},
+		{
+			// не буквы и не цифры — первый и последний символ hex-записи
+			name:   "alpn not alphanumeric",
+			modify: func(h *ClientHello) { h.ALPN = []string{"\xab\x01\xcd"} },
+			want:   "t13d1516ad_8daaf6152771_e5627efa2ab1",
+		},
+		{
+			name: "no alpn and no sni",
+			modify: func(h *ClientHello) {
+				h.ALPN = nil
+				h.ServerName = ""
+			},
+			want: "t13i151600_8daaf6152771_e5627efa2ab1",
+		},
+		{
+			// без supported_versions версия берётся из legacy_version
+			name:   "tls 1.2",
+			modify: func(h *ClientHello) { h.SupportedVersions = nil },
+			want:   "t12d1516h2_8daaf6152771_e5627efa2ab1",
+		},
+		{
+			name: "no ciphers",
+			modify: func(h *ClientHello) {
+				h.CipherSuites = []uint16{0x0a0a}
+			},
+			want: "t13d0016h2_000000000000_e5627efa2ab1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := chromeHello()
+			if tt.modify != nil {
+				tt.modify(h)
+			}
+			if got := h.JA4(); got != tt.want {
+				t.Errorf("JA4() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestJA3(t *testing.T) {
+	tests := []struct {
+		name    string
+		hello   *ClientHello
+		wantStr string
+		wantMD5 string
+	}{
+		{
+			// пример из описания JA3 (Salesforce)
+			name: "reference",
+			hello: &ClientHello{
+				Version:         769,
+				CipherSuites:    []uint16{47, 53, 5, 10, 49161, 49162, 49171, 49172, 50, 56, 19, 4},
+				Extensions:      []uint16{0, 10, 11},
+				SupportedGroups: []uint16{23, 24, 25},
+				PointFormats:    []uint8{0},
+			},
+			wantStr: "769,47-53-5-10-49161-49162-49171-49172-50-56-19-4,0-10-11,23-24-25,0",
+			wantMD5: "ada70206e40642a3e4461f35503241d5",
+		},
+		{
+			// GREASE выбрасывается, порядок остаётся исходным
+			name: "grease filtered, order kept",
+			hello: &ClientHello{
+				Version:         769,
+				CipherSuites:    []uint16{0x0a0a, 47, 53, 5, 10, 49161, 49162, 49171, 49172, 50, 56, 19, 4},
+				Extensions:      []uint16{0, 0xfafa, 10, 11},
+				SupportedGroups: []uint16{0x1a1a, 23, 24, 25},
+				PointFormats:    []uint8{0},
+			},
+			wantStr: "769,47-53-5-10-49161-49162-49171-49172-50-56-19-4,0-10-11,23-24-25,0",
+			wantMD5: "ada70206e40642a3e4461f35503241d5",
+		},
+		{
+			name:    "empty lists",
+			hello:   &ClientHello{Version: 771, CipherSuites: []uint16{4865}},
+			wantStr: "771,4865,,,",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			str, sum := tt.hello.JA3()
+			if str != tt.wantStr {
+				t.Errorf("JA3 string = %q, want %q", str, tt.wantStr)
+			}
+			if tt.wantMD5 != "" && sum != tt.wantMD5 {
+				t.Errorf("JA3 hash = %s, want %s", sum, tt.wantMD5)
+			}
+		})
+	}
+}
+
+func TestIsGrease(t *testing.T) {
+	tests := []struct {
+		v    uint16
+		want bool
+	}{
+		{0x0a0a, true},
+		{0x1a1a, true},
+		{0xfafa, true},
+		{0x0a1a, false},
+		{0x1301, false},
+		{0x0000, false},
+	}
+
+	for _, tt := range tests {
+		if got := isGrease(tt.v); got != tt.want {
+			t.Errorf("isGrease(%#04x) = %v, want %v", tt.v, got, tt.want)
+		}
+	}
+}
+
+// TestParseClientHello разбирает ClientHello, который отправляет crypto/tls.
+func TestParseClientHello(t *testing.T) {
+	client, server := net.Pipe()
+	go func() {
+		_ = tls.Client(client, &tls.Config{ServerName: "example.com", NextProtos: []string{"h2", "http/1.1"}}).Handshake()
+	}()
+	defer client.Close()
+	defer server.Close()
+
+	head := make([]byte, 5)
+	if _, err := io.ReadFull(server, head); err != nil {
+		t.Fatal(err)
+	}
+	body := make([]byte, int(head[3])<<8|int(head[4]))
+	if _, err := io.ReadFull(server, body); err != nil {
+		t.Fatal(err)
+	}
+	raw := append(head, body...)
+
+	h, err := ParseClientHello(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h.ServerName != "example.com" {
+		t.Errorf("ServerName = %q", h.ServerName)
+	}
+	if !slices.Equal(h.ALPN, []string{"h2", "http/1.1"}) {
+		t.Errorf("ALPN = %q", h.ALPN)
+	}
+	if !slices.Contains(h.SupportedVersions, 0x0304) {
+		t.Errorf("SupportedVersions = %#04x, want TLS 1.3", h.SupportedVersions)
+	}
+	if len(h.CipherSuites) == 0 || len(h.Extensions) == 0 {
+		t.Errorf("empty cipher suites or extensions: %+v", h)
+	}
+
+	// обрезанное сообщение — ошибка, а не паника
+	for _, n := range []int{0, 4, 5, 9, 40, len(raw) - 1} {
+		if _, err := ParseClientHello(raw[:n]); err == nil {
+			t.Errorf("ParseClientHello(raw[:%d]) = nil error", n)
+		}
+	}
+}
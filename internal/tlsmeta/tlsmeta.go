@@ -0,0 +1,73 @@
+package tlsmeta
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/hex"
+
+	"github.com/goriiin/go-proxy/internal/domain"
+)
+
+// Client собирает сведения о клиентской стороне: предложенное в
+// ClientHello (hello может быть nil, если его не удалось разобрать)
+// и согласованное с прокси.
+func Client(hello *ClientHello, state tls.ConnectionState) *domain.ClientTLS {
+	c := &domain.ClientTLS{
+		SNI:         state.ServerName,
+		Version:     tls.VersionName(state.Version),
+		CipherSuite: tls.CipherSuiteName(state.CipherSuite),
+		ALPN:        state.NegotiatedProtocol,
+	}
+	if hello == nil {
+		return c
+	}
+
+	versions := hello.SupportedVersions
+	if len(versions) == 0 {
+		versions = []uint16{hello.Version}
+	}
+	for _, v := range noGrease(versions) {
+		c.OfferedVersions = append(c.OfferedVersions, tls.VersionName(v))
+	}
+	for _, cs := range noGrease(hello.CipherSuites) {
+		c.OfferedCiphers = append(c.OfferedCiphers, tls.CipherSuiteName(cs))
+	}
+	c.OfferedALPN = hello.ALPN
+	c.JA3, c.JA3Hash = hello.JA3()
+	c.JA4 = hello.JA4()
+
+	return c
+}
+
+// Upstream собирает сведения о соединении прокси с сервером.
+func Upstream(state *tls.ConnectionState) *domain.UpstreamTLS {
+	if state == nil {
+		return nil
+	}
+
+	u := &domain.UpstreamTLS{
+		ServerName:  state.ServerName,
+		Version:     tls.VersionName(state.Version),
+		CipherSuite: tls.CipherSuiteName(state.CipherSuite),
+		ALPN:        state.NegotiatedProtocol,
+		Resumed:     state.DidResume,
+	}
+	if len(state.OCSPResponse) > 0 {
+		u.OCSPStaple = base64.StdEncoding.EncodeToString(state.OCSPResponse)
+	}
+	for _, cert := range state.PeerCertificates {
+		sum := sha256.Sum256(cert.Raw)
+		u.Chain = append(u.Chain, domain.CertInfo{
+			Subject:   cert.Subject.String(),
+			Issuer:    cert.Issuer.String(),
+			Serial:    cert.SerialNumber.Text(16),
+			NotBefore: cert.NotBefore.Unix(),
+			NotAfter:  cert.NotAfter.Unix(),
+			DNSNames:  cert.DNSNames,
+			SHA256:    hex.EncodeToString(sum[:]),
+		})
+	}
+
+	return u
+}
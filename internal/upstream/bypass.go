@@ -0,0 +1,70 @@
+package upstream
+
+import (
+	"net"
+	"strings"
+)
+
+// bypassRule — одно правило обхода вышестоящего прокси:
+// "*", точный хост, ".suffix" / "*.suffix", IP или подсеть CIDR.
+type bypassRule struct {
+	all    bool
+	host   string
+	suffix string
+	ipNet  *net.IPNet
+}
+
+func parseBypass(rules []string) []bypassRule {
+	var out []bypassRule
+	for _, r := range rules {
+		r = strings.ToLower(strings.TrimSpace(r))
+		switch {
+		case r == "":
+		case r == "*":
+			out = append(out, bypassRule{all: true})
+		case strings.HasPrefix(r, "*."):
+			out = append(out, bypassRule{suffix: r[1:]})
+		case strings.HasPrefix(r, "."):
+			out = append(out, bypassRule{suffix: r})
+		default:
+			if _, ipNet, err := net.ParseCIDR(r); err == nil {
+				out = append(out, bypassRule{ipNet: ipNet})
+				continue
+			}
+			out = append(out, bypassRule{host: strings.Trim(r, "[]")})
+		}
+	}
+
+	return out
+}
+
+func (r bypassRule) match(host string) bool {
+	switch {
+	case r.all:
+		return true
+	case r.ipNet != nil:
+		ip := net.ParseIP(host)
+		return ip != nil && r.ipNet.Contains(ip)
+	case r.suffix != "":
+		return strings.HasSuffix(host, r.suffix) || host == r.suffix[1:]
+	}
+
+	return host == r.host
+}
+
+// bypass сообщает, нужно ли идти к addr напрямую, минуя вышестоящий прокси.
+func (t *Transport) bypass(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		host = addr
+	}
+	host = strings.ToLower(strings.Trim(host, "[]"))
+
+	for _, r := range t.noProxy {
+		if r.match(host) {
+			return true
+		}
+	}
+
+	return false
+}
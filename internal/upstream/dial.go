@@ -0,0 +1,211 @@
+package upstream
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// Dial открывает TCP-соединение с addr через вышестоящий прокси (HTTP CONNECT
+// или SOCKS5), если он задан и addr не попал в правила обхода.
+func (t *Transport) Dial(ctx context.Context, addr string) (net.Conn, error) {
+	// соединение с вышестоящим прокси учитывается в статистике addr
+	ctx = context.WithValue(ctx, countersKey{}, t.host(addr))
+	if t.proxyURL == nil || t.bypass(addr) {
+		return t.dialDirect(ctx, "tcp", addr)
+	}
+
+	conn, err := t.dialDirect(ctx, "tcp", proxyAddr(t.proxyURL))
+	if err != nil {
+		return nil, fmt.Errorf("dial upstream proxy: %w", err)
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+		defer conn.SetDeadline(time.Time{})
+	}
+
+	switch t.proxyURL.Scheme {
+	case "socks5", "socks5h":
+		err = socks5Connect(conn, t.proxyURL.User, addr)
+	default:
+		err = httpConnect(conn, t.proxyURL.User, addr)
+	}
+	if err != nil {
+		_ = conn.Close()
+		return nil, fmt.Errorf("upstream proxy %s: %w", t.proxyURL.Host, err)
+	}
+
+	return conn, nil
+}
+
+// proxyFor — функция для http.Transport.Proxy с учётом правил обхода.
+func (t *Transport) proxyFor(req *http.Request) (*url.URL, error) {
+	if t.proxyURL == nil || t.bypass(hostPort(req)) {
+		return nil, nil
+	}
+
+	return t.proxyURL, nil
+}
+
+func proxyAddr(u *url.URL) string {
+	if u.Port() != "" {
+		return u.Host
+	}
+	switch u.Scheme {
+	case "socks5", "socks5h":
+		return net.JoinHostPort(u.Hostname(), "1080")
+	case "https":
+		return net.JoinHostPort(u.Hostname(), "443")
+	}
+
+	return net.JoinHostPort(u.Hostname(), "8080")
+}
+
+// httpConnect просит HTTP-прокси открыть туннель до addr.
+func httpConnect(conn net.Conn, user *url.Userinfo, addr string) error {
+	req := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: addr},
+		Host:   addr,
+		Header: make(http.Header),
+	}
+	if user != nil {
+		pass, _ := user.Password()
+		req.Header.Set("Proxy-Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(user.Username()+":"+pass)))
+	}
+	if err := req.Write(conn); err != nil {
+		return err
+	}
+
+	// читаем побайтно, чтобы не съесть начало данных туннеля
+	resp, err := http.ReadResponse(bufio.NewReaderSize(byteReader{conn}, 1), req)
+	if err != nil {
+		return err
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("CONNECT %s: %s", addr, resp.Status)
+	}
+
+	return nil
+}
+
+type byteReader struct{ r io.Reader }
+
+func (b byteReader) Read(p []byte) (int, error) {
+	if len(p) > 1 {
+		p = p[:1]
+	}
+	return b.r.Read(p)
+}
+
+// socks5Connect выполняет рукопожатие SOCKS5 (RFC 1928/1929) и команду CONNECT.
+func socks5Connect(conn net.Conn, user *url.Userinfo, addr string) error {
+	methods := []byte{0x00}
+	if user != nil {
+		methods = []byte{0x00, 0x02}
+	}
+	if _, err := conn.Write(append([]byte{0x05, byte(len(methods))}, methods...)); err != nil {
+		return err
+	}
+
+	reply := make([]byte, 2)
+	if _, err := io.ReadFull(conn, reply); err != nil {
+		return err
+	}
+	if reply[0] != 0x05 {
+		return errors.New("socks5: bad version in reply")
+	}
+
+	switch reply[1] {
+	case 0x00:
+	case 0x02:
+		if user == nil {
+			return errors.New("socks5: proxy requires authentication")
+		}
+		name := user.Username()
+		pass, _ := user.Password()
+		if len(name) > 255 || len(pass) > 255 {
+			return errors.New("socks5: credentials too long")
+		}
+		msg := []byte{0x01, byte(len(name))}
+		msg = append(msg, name...)
+		msg = append(msg, byte(len(pass)))
+		msg = append(msg, pass...)
+		if _, err := conn.Write(msg); err != nil {
+			return err
+		}
+		if _, err := io.ReadFull(conn, reply); err != nil {
+			return err
+		}
+		if reply[1] != 0x00 {
+			return errors.New("socks5: authentication failed")
+		}
+	default:
+		return errors.New("socks5: no acceptable authentication method")
+	}
+
+	host, portStr, err := net.SplitHostPort(addr)
+	if err != nil {
+		return err
+	}
+	port, err := strconv.ParseUint(portStr, 10, 16)
+	if err != nil {
+		return fmt.Errorf("socks5: bad port %q", portStr)
+	}
+
+	msg := []byte{0x05, 0x01, 0x00}
+	if ip := net.ParseIP(host); ip != nil {
+		if ip4 := ip.To4(); ip4 != nil {
+			msg = append(append(msg, 0x01), ip4...)
+		} else {
+			msg = append(append(msg, 0x04), ip.To16()...)
+		}
+	} else {
+		if len(host) > 255 {
+			return errors.New("socks5: host name too long")
+		}
+		msg = append(msg, 0x03, byte(len(host)))
+		msg = append(msg, host...)
+	}
+	msg = binary.BigEndian.AppendUint16(msg, uint16(port))
+	if _, err = conn.Write(msg); err != nil {
+		return err
+	}
+
+	head := make([]byte, 4)
+	if _, err = io.ReadFull(conn, head); err != nil {
+		return err
+	}
+	if head[1] != 0x00 {
+		return fmt.Errorf("socks5: connect failed with code %d", head[1])
+	}
+
+	var skip int
+	switch head[3] {
+	case 0x01:
+		skip = net.IPv4len
+	case 0x04:
+		skip = net.IPv6len
+	case 0x03:
+		l := make([]byte, 1)
+		if _, err = io.ReadFull(conn, l); err != nil {
+			return err
+		}
+		skip = int(l[0])
+	default:
+		return errors.New("socks5: bad address type in reply")
+	}
+	_, err = io.CopyN(io.Discard, conn, int64(skip+2))
+
+	return err
+}
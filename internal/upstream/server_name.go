@@ -0,0 +1,73 @@
+package upstream
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// maxNamedTransports — сколько пулов с подменённым именем сервера держать;
+// дольше всех не использованный закрывается первым.
+const maxNamedTransports = 256
+
+type serverNameKey struct{}
+
+// WithServerName задаёт имя сервера для TLS с сервером назначения (SNI и
+// проверка сертификата), если оно не совпадает с хостом из URL: клиент
+// подключился к IP, а в ClientHello назвал имя. Профиль TLS выбирается
+// по этому имени, а соединение всё равно открывается с хостом из URL.
+func WithServerName(ctx context.Context, name string) context.Context {
+	return context.WithValue(ctx, serverNameKey{}, strings.ToLower(name))
+}
+
+// namedTransport — пул соединений с фиксированным ServerName. Пул
+// http.Transport различает соединения только по адресу, поэтому для
+// каждого имени нужен свой, иначе соединение с одним SNI досталось бы
+// запросу с другим.
+type namedTransport struct {
+	transport *http.Transport
+	used      time.Time
+}
+
+// transportFor возвращает пул для запроса https к серверу с именем name.
+func (t *Transport) transportFor(req *http.Request) *http.Transport {
+	host := strings.ToLower(req.URL.Hostname())
+	name, _ := req.Context().Value(serverNameKey{}).(string)
+	if name == "" || name == host {
+		if r := t.tlsRuleFor(host); r != nil {
+			return r.transport
+		}
+		return t.base
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	nt, ok := t.named[name]
+	if !ok {
+		if len(t.named) >= maxNamedTransports {
+			t.evictNamed()
+		}
+		tr := t.base.Clone()
+		tr.TLSClientConfig = t.TLSConfig(name)
+		nt = &namedTransport{transport: tr}
+		t.named[name] = nt
+	}
+	nt.used = time.Now()
+
+	return nt.transport
+}
+
+// evictNamed закрывает пул, который дольше всех не использовался.
+// Вызывается под t.mu.
+func (t *Transport) evictNamed() {
+	var oldest string
+	for name, nt := range t.named {
+		if oldest == "" || nt.used.Before(t.named[oldest].used) {
+			oldest = name
+		}
+	}
+	t.named[oldest].transport.CloseIdleConnections()
+	delete(t.named, oldest)
+}
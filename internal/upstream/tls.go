@@ -0,0 +1,152 @@
+package upstream
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+)
+
+// TLSProfile — настройки TLS к серверам, имя которых подходит под Host.
+type TLSProfile struct {
+	Host         string   `json:"host"` // glob, "*" — все серверы
+	ClientCert   string   `json:"client_cert,omitempty"`
+	ClientKey    string   `json:"client_key,omitempty"`
+	RootCAs      []string `json:"root_cas,omitempty"` // добавляются к системным
+	Insecure     bool     `json:"insecure,omitempty"`
+	MinVersion   string   `json:"min_version,omitempty"` // "1.0" … "1.3"
+	MaxVersion   string   `json:"max_version,omitempty"`
+	CipherSuites []string `json:"cipher_suites,omitempty"` // имена из crypto/tls
+}
+
+// LoadTLSProfiles читает JSON-массив профилей. Порядок важен: для сервера
+// берётся первый подходящий профиль.
+func LoadTLSProfiles(file string) ([]TLSProfile, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	var profiles []TLSProfile
+	if err = json.Unmarshal(data, &profiles); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", file, err)
+	}
+
+	return profiles, nil
+}
+
+// tlsRule — профиль с готовым tls.Config и собственным пулом соединений:
+// у http.Transport одна TLS-конфигурация на все хосты.
+type tlsRule struct {
+	host      string
+	config    *tls.Config
+	transport *http.Transport
+}
+
+func (p TLSProfile) config() (*tls.Config, error) {
+	if _, err := path.Match(p.Host, ""); err != nil || p.Host == "" {
+		return nil, fmt.Errorf("bad host pattern %q", p.Host)
+	}
+
+	cfg := &tls.Config{InsecureSkipVerify: p.Insecure}
+
+	if p.ClientCert != "" {
+		cert, err := tls.LoadX509KeyPair(p.ClientCert, p.ClientKey)
+		if err != nil {
+			return nil, fmt.Errorf("client certificate for %s: %w", p.Host, err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+
+	if len(p.RootCAs) > 0 {
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		for _, f := range p.RootCAs {
+			data, err := os.ReadFile(f)
+			if err != nil {
+				return nil, err
+			}
+			if !pool.AppendCertsFromPEM(data) {
+				return nil, fmt.Errorf("%s: no certificates found", f)
+			}
+		}
+		cfg.RootCAs = pool
+	}
+
+	var err error
+	if cfg.MinVersion, err = tlsVersion(p.MinVersion); err != nil {
+		return nil, err
+	}
+	if cfg.MaxVersion, err = tlsVersion(p.MaxVersion); err != nil {
+		return nil, err
+	}
+
+	for _, name := range p.CipherSuites {
+		id, ok := cipherSuite(name)
+		if !ok {
+			return nil, fmt.Errorf("unknown cipher suite %q", name)
+		}
+		cfg.CipherSuites = append(cfg.CipherSuites, id)
+	}
+
+	return cfg, nil
+}
+
+func tlsVersion(v string) (uint16, error) {
+	switch strings.TrimPrefix(strings.ToLower(v), "tls") {
+	case "":
+		return 0, nil
+	case "1.0", "10":
+		return tls.VersionTLS10, nil
+	case "1.1", "11":
+		return tls.VersionTLS11, nil
+	case "1.2", "12":
+		return tls.VersionTLS12, nil
+	case "1.3", "13":
+		return tls.VersionTLS13, nil
+	}
+
+	return 0, fmt.Errorf("unknown TLS version %q", v)
+}
+
+func cipherSuite(name string) (uint16, bool) {
+	for _, list := range [][]*tls.CipherSuite{tls.CipherSuites(), tls.InsecureCipherSuites()} {
+		for _, cs := range list {
+			if cs.Name == name {
+				return cs.ID, true
+			}
+		}
+	}
+
+	return 0, false
+}
+
+// tlsRuleFor — первый профиль, подходящий под имя сервера, или nil.
+func (t *Transport) tlsRuleFor(host string) *tlsRule {
+	host = strings.ToLower(host)
+	for _, r := range t.tlsRules {
+		if ok, _ := path.Match(r.host, host); ok {
+			return r
+		}
+	}
+
+	return nil
+}
+
+// TLSConfig возвращает копию TLS-настроек для сервера host с заполненным
+// ServerName — для соединений, которые прокси открывает сам, минуя RoundTrip.
+func (t *Transport) TLSConfig(host string) *tls.Config {
+	cfg := &tls.Config{}
+	if r := t.tlsRuleFor(host); r != nil {
+		cfg = r.config.Clone()
+	}
+	cfg.ServerName = host
+
+	return cfg
+}
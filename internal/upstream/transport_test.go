@@ -0,0 +1,93 @@
+package upstream
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+// Через вышестоящий прокси соединения и запросы считаются по хосту
+// назначения, а не по адресу прокси.
+func TestStatsKeyedByTarget(t *testing.T) {
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, r.URL.Host)
+	}))
+	defer proxy.Close()
+
+	proxyURL, _ := url.Parse(proxy.URL)
+	tr, err := New(Options{Proxy: proxyURL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tr.CloseIdleConnections()
+
+	for i := 0; i < 2; i++ {
+		req, _ := http.NewRequest(http.MethodGet, "http://target.test/", nil)
+		resp, err := tr.RoundTrip(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, _ = io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+	}
+
+	st := tr.Stats()
+	if _, ok := st.Hosts[proxyURL.Host]; ok {
+		t.Errorf("stats keyed by the proxy address: %+v", st.Hosts)
+	}
+	want := HostStats{Requests: 2, NewConns: 1, Reused: 1, Open: 1}
+	if got := st.Hosts["target.test:80"]; got != want {
+		t.Errorf("target.test:80 = %+v, want %+v", got, want)
+	}
+}
+
+func TestHostEviction(t *testing.T) {
+	tr, err := New(Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	busy := tr.host("busy:443")
+	busy.open.Add(1)
+	idle := tr.host("idle:443")
+	idle.requests.Add(5)
+	tr.host("fresh:443")
+
+	// idle и busy простаивают дольше hostStatsIdle, но у busy есть соединение
+	old := time.Now().Add(-2 * hostStatsIdle)
+	tr.mu.Lock()
+	busy.used, idle.used = old, old
+	tr.mu.Unlock()
+
+	st := tr.Stats()
+	if _, ok := st.Hosts["idle:443"]; ok {
+		t.Error("idle host not expired")
+	}
+	if _, ok := st.Hosts["busy:443"]; !ok {
+		t.Error("host with an open connection expired")
+	}
+	if st.Total.Requests != 5 {
+		t.Errorf("Total.Requests = %d, want 5 after eviction", st.Total.Requests)
+	}
+
+	// при переполнении уходит самый давний хост без соединений
+	for i := len(tr.hosts); i < maxTrackedHosts; i++ {
+		tr.host(fmt.Sprintf("h%d:443", i))
+	}
+	tr.mu.Lock()
+	tr.hosts["fresh:443"].used = time.Now().Add(-time.Minute)
+	tr.mu.Unlock()
+	tr.host("new:443")
+
+	st = tr.Stats()
+	if len(st.Hosts) != maxTrackedHosts {
+		t.Errorf("%d hosts tracked, want %d", len(st.Hosts), maxTrackedHosts)
+	}
+	if _, ok := st.Hosts["fresh:443"]; ok {
+		t.Error("oldest idle host not evicted")
+	}
+}
@@ -0,0 +1,282 @@
+// Package websocket разбирает и собирает кадры WebSocket (RFC 6455),
+// чтобы прокси мог сохранять сообщения, пересылая кадры без изменений.
+package websocket
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/goriiin/go-proxy/internal/domain"
+)
+
+const (
+	OpContinuation = 0x0
+	OpText         = 0x1
+	OpBinary       = 0x2
+	OpClose        = 0x8
+	OpPing         = 0x9
+	OpPong         = 0xa
+)
+
+// MaxPayload — предел длины кадра для ReadFrame, который держит кадр в
+// памяти целиком. CopyPayload длину не ограничивает.
+const MaxPayload = 64 << 20
+
+// copyChunk — по сколько байт CopyPayload пересылает данные кадра.
+const copyChunk = 32 << 10
+
+var ErrTooLarge = errors.New("websocket: frame too large")
+
+// Frame — кадр WebSocket с уже снятой маской.
+type Frame struct {
+	Fin     bool
+	Rsv     byte // биты RSV1-3 в позициях 0x70
+	Opcode  byte
+	Masked  bool
+	Mask    [4]byte
+	Payload []byte
+	// Size — длина данных кадра; больше len(Payload), если Truncated.
+	Size uint64
+	// Truncated — в Payload только начало данных (см. CopyPayload).
+	Truncated bool
+}
+
+// IsControl — кадр управления (close, ping, pong).
+func (f *Frame) IsControl() bool {
+	return f.Opcode&0x8 != 0
+}
+
+// ReadFrame читает один кадр. Возвращает кадр с размаскированными данными
+// и его исходные байты, которые можно переслать дальше как есть.
+func ReadFrame(r io.Reader) (*Frame, []byte, error) {
+	f, head, err := ReadHeader(r)
+	if err != nil {
+		return nil, nil, err
+	}
+	if f.Size > MaxPayload {
+		return nil, nil, fmt.Errorf("%w: %d bytes", ErrTooLarge, f.Size)
+	}
+
+	raw := make([]byte, len(head)+int(f.Size))
+	copy(raw, head)
+	if _, err := io.ReadFull(r, raw[len(head):]); err != nil {
+		return nil, nil, err
+	}
+	f.Payload = append([]byte(nil), raw[len(head):]...)
+	if f.Masked {
+		mask(f.Payload, f.Mask)
+	}
+
+	return f, raw, nil
+}
+
+// ReadHeader читает заголовок кадра. Возвращает кадр без данных (их длина
+// — в Size) и исходные байты заголовка.
+func ReadHeader(r io.Reader) (*Frame, []byte, error) {
+	head := make([]byte, 2, 14)
+	if _, err := io.ReadFull(r, head); err != nil {
+		return nil, nil, err
+	}
+
+	f := &Frame{
+		Fin:    head[0]&0x80 != 0,
+		Rsv:    head[0] & 0x70,
+		Opcode: head[0] & 0x0f,
+		Masked: head[1]&0x80 != 0,
+	}
+
+	n := uint64(head[1] & 0x7f)
+	ext := 0
+	switch n {
+	case 126:
+		ext = 2
+	case 127:
+		ext = 8
+	}
+	if f.Masked {
+		ext += 4
+	}
+	if ext > 0 {
+		head = head[:2+ext]
+		if _, err := io.ReadFull(r, head[2:]); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	rest := head[2:]
+	switch n {
+	case 126:
+		n, rest = uint64(binary.BigEndian.Uint16(rest)), rest[2:]
+	case 127:
+		n, rest = binary.BigEndian.Uint64(rest), rest[8:]
+	}
+	if f.Masked {
+		copy(f.Mask[:], rest)
+	}
+	if f.IsControl() && (n > 125 || !f.Fin) {
+		return nil, nil, errors.New("websocket: bad control frame")
+	}
+	f.Size = n
+
+	return f, head, nil
+}
+
+// CopyPayload пересылает данные кадра f из src в dst как есть, частями, не
+// держа кадр в памяти целиком, и оставляет в f.Payload первые keep байт без
+// маски. Если данные длиннее, f.Truncated = true.
+func CopyPayload(dst io.Writer, src io.Reader, f *Frame, keep int) error {
+	buf := make([]byte, min(uint64(copyChunk), f.Size))
+	f.Payload = nil
+	for left := f.Size; left > 0; {
+		chunk := buf[:min(uint64(len(buf)), left)]
+		if _, err := io.ReadFull(src, chunk); err != nil {
+			return err
+		}
+		if _, err := dst.Write(chunk); err != nil {
+			return err
+		}
+		if room := keep - len(f.Payload); room > 0 {
+			f.Payload = append(f.Payload, chunk[:min(len(chunk), room)]...)
+		}
+		left -= uint64(len(chunk))
+	}
+	f.Truncated = uint64(len(f.Payload)) < f.Size
+	if f.Masked {
+		mask(f.Payload, f.Mask)
+	}
+
+	return nil
+}
+
+// WriteFrame кодирует кадр. Клиент обязан маскировать кадры: если
+// Masked установлен, а ключ нулевой, он генерируется случайно.
+func WriteFrame(w io.Writer, f *Frame) error {
+	b := make([]byte, 0, 14+len(f.Payload))
+
+	first := f.Rsv&0x70 | f.Opcode&0x0f
+	if f.Fin {
+		first |= 0x80
+	}
+	b = append(b, first)
+
+	var maskBit byte
+	if f.Masked {
+		maskBit = 0x80
+	}
+	switch n := len(f.Payload); {
+	case n <= 125:
+		b = append(b, maskBit|byte(n))
+	case n <= 0xffff:
+		b = append(b, maskBit|126)
+		b = binary.BigEndian.AppendUint16(b, uint16(n))
+	default:
+		b = append(b, maskBit|127)
+		b = binary.BigEndian.AppendUint64(b, uint64(n))
+	}
+
+	payload := f.Payload
+	if f.Masked {
+		if f.Mask == [4]byte{} {
+			if _, err := rand.Read(f.Mask[:]); err != nil {
+				return err
+			}
+		}
+		b = append(b, f.Mask[:]...)
+		payload = append([]byte(nil), payload...)
+		mask(payload, f.Mask)
+	}
+	b = append(b, payload...)
+
+	_, err := w.Write(b)
+	return err
+}
+
+func mask(b []byte, key [4]byte) {
+	for i := range b {
+		b[i] ^= key[i%4]
+	}
+}
+
+// Message — сообщение, собранное из одного или нескольких кадров.
+type Message struct {
+	Opcode  byte
+	Payload []byte
+	// Size — полная длина сообщения; больше len(Payload), если Truncated.
+	Size int64
+	// Truncated — в Payload только начало сообщения.
+	Truncated bool
+}
+
+// EncodingBase64 — данные сообщения хранятся и передаются в base64.
+const EncodingBase64 = "base64"
+
+// Encode возвращает данные сообщения для хранения: текст в UTF-8 как есть,
+// всё остальное — в base64 с непустой кодировкой.
+func (m *Message) Encode() (payload, encoding string) {
+	if m.Opcode == OpText && !domain.IsBinary(m.Payload, m.Truncated) {
+		return string(m.Payload), ""
+	}
+
+	return base64.StdEncoding.EncodeToString(m.Payload), EncodingBase64
+}
+
+// Decode — обратное к Encode преобразование.
+func Decode(payload, encoding string) ([]byte, error) {
+	switch encoding {
+	case "":
+		return []byte(payload), nil
+	case EncodingBase64:
+		return base64.StdEncoding.DecodeString(payload)
+	}
+
+	return nil, fmt.Errorf("websocket: unknown encoding %q", encoding)
+}
+
+// Assembler собирает фрагментированные сообщения одного направления.
+// Кадры управления могут приходить между фрагментами и отдаются сразу.
+// Limit > 0 ограничивает, сколько байт сообщения хранится: остальное
+// только считается, а сообщение помечается Truncated.
+type Assembler struct {
+	Limit int
+
+	opcode    byte
+	payload   []byte
+	size      int64
+	truncated bool
+	partial   bool
+}
+
+// Push добавляет кадр и возвращает сообщение, если оно завершено.
+func (a *Assembler) Push(f *Frame) *Message {
+	if f.IsControl() {
+		return &Message{Opcode: f.Opcode, Payload: f.Payload, Size: int64(len(f.Payload))}
+	}
+
+	if f.Opcode != OpContinuation || !a.partial {
+		a.opcode, a.payload, a.size, a.truncated = f.Opcode, nil, 0, false
+	}
+	size := int64(len(f.Payload))
+	if f.Truncated {
+		size = int64(f.Size)
+	}
+	payload := f.Payload
+	if a.Limit > 0 && len(a.payload)+len(payload) > a.Limit {
+		payload = payload[:max(a.Limit-len(a.payload), 0)]
+	}
+	a.payload = append(a.payload, payload...)
+	a.size += size
+	a.truncated = a.truncated || int64(len(payload)) < size
+	a.partial = !f.Fin
+	if a.partial {
+		return nil
+	}
+
+	m := &Message{Opcode: a.opcode, Payload: a.payload, Size: a.size, Truncated: a.truncated}
+	a.payload = nil
+
+	return m
+}
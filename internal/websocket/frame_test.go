@@ -0,0 +1,302 @@
+package websocket
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+// errAny — в тесте подходит любая ошибка.
+var errAny = errors.New("any error")
+
+// Примеры кадров из RFC 6455, раздел 5.7.
+func TestReadFrame(t *testing.T) {
+	tests := []struct {
+		name    string
+		raw     []byte
+		want    Frame
+		wantErr error
+	}{
+		{
+			name: "unmasked text",
+			raw:  []byte{0x81, 0x05, 'H', 'e', 'l', 'l', 'o'},
+			want: Frame{Fin: true, Opcode: OpText, Payload: []byte("Hello"), Size: 5},
+		},
+		{
+			name: "masked text",
+			raw:  []byte{0x81, 0x85, 0x37, 0xfa, 0x21, 0x3d, 0x7f, 0x9f, 0x4d, 0x51, 0x58},
+			want: Frame{Fin: true, Opcode: OpText, Masked: true, Mask: [4]byte{0x37, 0xfa, 0x21, 0x3d}, Payload: []byte("Hello"), Size: 5},
+		},
+		{
+			name: "first fragment",
+			raw:  []byte{0x01, 0x03, 'H', 'e', 'l'},
+			want: Frame{Opcode: OpText, Payload: []byte("Hel"), Size: 3},
+		},
+		{
+			name: "ping",
+			raw:  []byte{0x89, 0x05, 'H', 'e', 'l', 'l', 'o'},
+			want: Frame{Fin: true, Opcode: OpPing, Payload: []byte("Hello"), Size: 5},
+		},
+		{
+			name: "256 bytes, 16-bit length",
+			raw:  append([]byte{0x82, 0x7e, 0x01, 0x00}, make([]byte, 256)...),
+			want: Frame{Fin: true, Opcode: OpBinary, Payload: make([]byte, 256), Size: 256},
+		},
+		{
+			name: "64 KiB, 64-bit length",
+			raw:  append([]byte{0x82, 0x7f, 0, 0, 0, 0, 0, 1, 0, 0}, make([]byte, 65536)...),
+			want: Frame{Fin: true, Opcode: OpBinary, Payload: make([]byte, 65536), Size: 65536},
+		},
+		{
+			name: "rsv1",
+			raw:  []byte{0xc1, 0x01, 'x'},
+			want: Frame{Fin: true, Rsv: 0x40, Opcode: OpText, Payload: []byte("x"), Size: 1},
+		},
+		{
+			name:    "too large",
+			raw:     []byte{0x82, 0x7f, 0, 0, 0, 0, 0x10, 0, 0, 0},
+			wantErr: ErrTooLarge,
+		},
+		{
+			name:    "control frame too long",
+			raw:     append([]byte{0x89, 0x7e, 0x00, 0x7e}, make([]byte, 126)...),
+			wantErr: errAny,
+		},
+		{
+			name:    "fragmented control frame",
+			raw:     []byte{0x09, 0x00},
+			wantErr: errAny,
+		},
+		{
+			name:    "truncated payload",
+			raw:     []byte{0x81, 0x05, 'H', 'e'},
+			wantErr: io.ErrUnexpectedEOF,
+		},
+		{
+			name:    "truncated length",
+			raw:     []byte{0x82, 0x7e, 0x01},
+			wantErr: io.ErrUnexpectedEOF,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, raw, err := ReadFrame(bytes.NewReader(tt.raw))
+			if tt.wantErr != nil {
+				if err == nil || tt.wantErr != errAny && !errors.Is(err, tt.wantErr) {
+					t.Fatalf("err = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(raw, tt.raw) {
+				t.Errorf("raw bytes differ from input")
+			}
+			if f.Fin != tt.want.Fin || f.Rsv != tt.want.Rsv || f.Opcode != tt.want.Opcode ||
+				f.Masked != tt.want.Masked || f.Mask != tt.want.Mask || f.Size != tt.want.Size ||
+				!bytes.Equal(f.Payload, tt.want.Payload) {
+				t.Errorf("frame = %+v, want %+v", f, tt.want)
+			}
+		})
+	}
+}
+
+func TestWriteFrame(t *testing.T) {
+	tests := []struct {
+		name string
+		f    Frame
+	}{
+		{"empty", Frame{Fin: true, Opcode: OpText}},
+		{"125 bytes", Frame{Fin: true, Opcode: OpBinary, Payload: bytes.Repeat([]byte{1}, 125)}},
+		{"126 bytes", Frame{Fin: true, Opcode: OpBinary, Payload: bytes.Repeat([]byte{2}, 126)}},
+		{"65536 bytes", Frame{Fin: true, Opcode: OpBinary, Payload: bytes.Repeat([]byte{3}, 65536)}},
+		{"masked", Frame{Fin: true, Opcode: OpText, Masked: true, Payload: []byte("Hello")}},
+		{"fragment", Frame{Opcode: OpText, Payload: []byte("Hel")}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			in := tt.f
+			var buf bytes.Buffer
+			if err := WriteFrame(&buf, &in); err != nil {
+				t.Fatal(err)
+			}
+			if in.Masked && in.Mask == [4]byte{} {
+				t.Error("mask key not generated")
+			}
+
+			f, _, err := ReadFrame(&buf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if f.Fin != tt.f.Fin || f.Opcode != tt.f.Opcode || f.Masked != tt.f.Masked || !bytes.Equal(f.Payload, tt.f.Payload) {
+				t.Errorf("round trip = %+v, want %+v", f, tt.f)
+			}
+		})
+	}
+}
+
+func TestCopyPayload(t *testing.T) {
+	tests := []struct {
+		name          string
+		payload       []byte
+		masked        bool
+		keep          int
+		wantKept      int
+		wantTruncated bool
+	}{
+		{"fits", []byte("Hello"), false, 10, 5, false},
+		{"exact", []byte("Hello"), true, 5, 5, false},
+		{"cut", []byte("Hello"), true, 2, 2, true},
+		{"nothing kept", []byte("Hello"), false, 0, 0, true},
+		{"empty", nil, false, 10, 0, false},
+		{"several chunks", bytes.Repeat([]byte("abc"), copyChunk), true, copyChunk + 7, copyChunk + 7, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var src bytes.Buffer
+			if err := WriteFrame(&src, &Frame{Fin: true, Opcode: OpBinary, Masked: tt.masked, Payload: tt.payload}); err != nil {
+				t.Fatal(err)
+			}
+			raw := bytes.Clone(src.Bytes())
+
+			f, head, err := ReadHeader(&src)
+			if err != nil {
+				t.Fatal(err)
+			}
+			dst := bytes.NewBuffer(bytes.Clone(head))
+			if err := CopyPayload(dst, &src, f, tt.keep); err != nil {
+				t.Fatal(err)
+			}
+
+			if !bytes.Equal(dst.Bytes(), raw) {
+				t.Error("forwarded bytes differ from the original frame")
+			}
+			if f.Size != uint64(len(tt.payload)) {
+				t.Errorf("Size = %d, want %d", f.Size, len(tt.payload))
+			}
+			if !bytes.Equal(f.Payload, tt.payload[:tt.wantKept]) || f.Truncated != tt.wantTruncated {
+				t.Errorf("kept %q (truncated %v), want %q (truncated %v)", f.Payload, f.Truncated, tt.payload[:tt.wantKept], tt.wantTruncated)
+			}
+		})
+	}
+
+	t.Run("short source", func(t *testing.T) {
+		f := &Frame{Opcode: OpBinary, Size: 10}
+		if err := CopyPayload(io.Discard, strings.NewReader("abc"), f, 10); !errors.Is(err, io.ErrUnexpectedEOF) {
+			t.Errorf("err = %v, want %v", err, io.ErrUnexpectedEOF)
+		}
+	})
+}
+
+func TestAssembler(t *testing.T) {
+	text := func(fin bool, op byte, s string) *Frame {
+		return &Frame{Fin: fin, Opcode: op, Payload: []byte(s), Size: uint64(len(s))}
+	}
+
+	tests := []struct {
+		name   string
+		limit  int
+		frames []*Frame
+		want   []Message
+	}{
+		{
+			name:   "single frame",
+			frames: []*Frame{text(true, OpText, "Hello")},
+			want:   []Message{{Opcode: OpText, Payload: []byte("Hello"), Size: 5}},
+		},
+		{
+			// ping между фрагментами отдаётся сразу, сообщение — после последнего
+			name: "fragments with ping",
+			frames: []*Frame{
+				text(false, OpText, "Hel"),
+				text(true, OpPing, "p"),
+				text(true, OpContinuation, "lo"),
+			},
+			want: []Message{
+				{Opcode: OpPing, Payload: []byte("p"), Size: 1},
+				{Opcode: OpText, Payload: []byte("Hello"), Size: 5},
+			},
+		},
+		{
+			name:  "limit across fragments",
+			limit: 4,
+			frames: []*Frame{
+				text(false, OpBinary, "abc"),
+				text(false, OpContinuation, "def"),
+				text(true, OpContinuation, "gh"),
+			},
+			want: []Message{{Opcode: OpBinary, Payload: []byte("abcd"), Size: 8, Truncated: true}},
+		},
+		{
+			// кадр, от которого CopyPayload сохранил только начало
+			name:   "truncated frame",
+			limit:  10,
+			frames: []*Frame{{Fin: true, Opcode: OpText, Payload: []byte("Hel"), Size: 1000, Truncated: true}},
+			want:   []Message{{Opcode: OpText, Payload: []byte("Hel"), Size: 1000, Truncated: true}},
+		},
+		{
+			// новое сообщение без завершения предыдущего начинает его заново
+			name: "unfinished message replaced",
+			frames: []*Frame{
+				text(false, OpText, "lost"),
+				text(true, OpText, "next"),
+			},
+			want: []Message{{Opcode: OpText, Payload: []byte("next"), Size: 4}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			asm := Assembler{Limit: tt.limit}
+			var got []Message
+			for _, f := range tt.frames {
+				if m := asm.Push(f); m != nil {
+					got = append(got, *m)
+				}
+			}
+
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %d messages, want %d: %+v", len(got), len(tt.want), got)
+			}
+			for i := range got {
+				g, w := got[i], tt.want[i]
+				if g.Opcode != w.Opcode || !bytes.Equal(g.Payload, w.Payload) || g.Size != w.Size || g.Truncated != w.Truncated {
+					t.Errorf("message %d = %+v, want %+v", i, g, w)
+				}
+			}
+		})
+	}
+}
+
+func TestMessageEncode(t *testing.T) {
+	tests := []struct {
+		name         string
+		msg          Message
+		wantPayload  string
+		wantEncoding string
+	}{
+		{"text", Message{Opcode: OpText, Payload: []byte("привет")}, "привет", ""},
+		{"invalid utf-8 text", Message{Opcode: OpText, Payload: []byte{0xff}}, "/w==", EncodingBase64},
+		{"binary", Message{Opcode: OpBinary, Payload: []byte("abc")}, "YWJj", EncodingBase64},
+		// обрезка посреди символа не делает текст двоичным
+		{"truncated mid-rune", Message{Opcode: OpText, Payload: []byte("при")[:5], Truncated: true}, "пр\xd0", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			payload, encoding := tt.msg.Encode()
+			if payload != tt.wantPayload || encoding != tt.wantEncoding {
+				t.Errorf("Encode() = %q, %q, want %q, %q", payload, encoding, tt.wantPayload, tt.wantEncoding)
+			}
+			if back, err := Decode(payload, encoding); err != nil || !bytes.Equal(back, tt.msg.Payload) {
+				t.Errorf("Decode() = %q, %v, want %q", back, err, tt.msg.Payload)
+			}
+		})
+	}
+}
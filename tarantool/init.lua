@@ -13,3 +13,44 @@ s:format({
   { name = 'ts',     type = 'unsigned' },
 })
 s:create_index('primary', { parts = { 'id' }, sequence = 'req_seq', if_not_exists = true })
+
+-- правила Match & Replace
+local rr = box.schema.space.create('rewrite_rules', { if_not_exists = true })
+rr:format({
+  { name = 'id',   type = 'string' },
+  { name = 'rule', type = 'map'    },
+})
+rr:create_index('primary', { parts = { 'id' }, if_not_exists = true })
+
+-- поддельные сертификаты (PEM цепочки и ключа), чтобы не выпускать их после перезапуска
+local c = box.schema.space.create('certs', { if_not_exists = true })
+c:format({
+  { name = 'host', type = 'string'   },
+  { name = 'pem',  type = 'string'   },
+  { name = 'ts',   type = 'unsigned' },
+})
+c:create_index('primary', { parts = { 'host' }, if_not_exists = true })
+
+-- сообщения WebSocket, привязанные к запросу-рукопожатию
+box.schema.sequence.create('ws_seq', { if_not_exists = true })
+
+local ws = box.schema.space.create('ws_messages', { if_not_exists = true })
+ws:format({
+  { name = 'id',         type = 'unsigned' },
+  { name = 'request_id', type = 'unsigned' },
+  { name = 'message',    type = 'map'      },
+})
+ws:create_index('primary', { parts = { 'id' }, sequence = 'ws_seq', if_not_exists = true })
+ws:create_index('request', { parts = { 'request_id' }, unique = false, if_not_exists = true })
+
+-- события Server-Sent Events, привязанные к запросу
+box.schema.sequence.create('sse_seq', { if_not_exists = true })
+
+local sse = box.schema.space.create('sse_events', { if_not_exists = true })
+sse:format({
+  { name = 'id',         type = 'unsigned' },
+  { name = 'request_id', type = 'unsigned' },
+  { name = 'event',      type = 'map'      },
+})
+sse:create_index('primary', { parts = { 'id' }, sequence = 'sse_seq', if_not_exists = true })
+sse:create_index('request', { parts = { 'request_id' }, unique = false, if_not_exists = true })